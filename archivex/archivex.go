@@ -31,9 +31,19 @@ type Archivex interface {
 }
 
 // ArchiveWriteFunc is the closure used by an archive's AddAll method to actually put a file into an archive
-// Note that for directory entries, this func will be called with a nil 'file' param
+// Note that for directory entries, this func will be called with a nil 'file' param,
+// and for symlinks 'file' reads the link target
 type ArchiveWriteFunc func(info os.FileInfo, file io.Reader, entryName string) (err error)
 
+// ArchiveFilterFunc is called by AddAllFilter for each entry, returning false skips the entry and,
+// for a directory, everything below it
+type ArchiveFilterFunc func(info os.FileInfo, entryName string) bool
+
+// skipHidden is the filter of AddAll, it skips the entries starting with a dot
+func skipHidden(info os.FileInfo, entryName string) bool {
+	return info.Name()[0] != '.'
+}
+
 // ZipFile implement *zip.Writer
 type ZipFile struct {
 	Writer *zip.Writer
@@ -105,7 +115,7 @@ func (z *ZipFile) Add(name string, file io.Reader, info os.FileInfo) error {
 // Directories receive a zero-size entry in the archive, with a trailing slash in the header name, and no compression
 func (z *ZipFile) AddAll(dir string, includeCurrentFolder bool) error {
 	dir = path.Clean(dir)
-	return addAll(dir, dir, includeCurrentFolder, func(info os.FileInfo, file io.Reader, entryName string) (err error) {
+	return addAll(dir, dir, includeCurrentFolder, skipHidden, func(info os.FileInfo, file io.Reader, entryName string) (err error) {
 		// Create a header based off of the fileinfo
 		header, err := zip.FileInfoHeader(info)
 		if err != nil {
@@ -254,8 +264,13 @@ func (t *TarFile) Add(name string, file io.Reader, info os.FileInfo) error {
 // AddAll adds all files from dir in archive
 // Tar does not support directories
 func (t *TarFile) AddAll(dir string, includeCurrentFolder bool) error {
+	return t.AddAllFilter(dir, includeCurrentFolder, skipHidden)
+}
+
+// AddAllFilter adds the files from dir accepted by filter in archive, hidden files are not skipped
+func (t *TarFile) AddAllFilter(dir string, includeCurrentFolder bool, filter ArchiveFilterFunc) error {
 	dir = path.Clean(dir)
-	return addAll(dir, dir, includeCurrentFolder, func(info os.FileInfo, file io.Reader, entryName string) (err error) {
+	return addAll(dir, dir, includeCurrentFolder, filter, func(info os.FileInfo, file io.Reader, entryName string) (err error) {
 		// Create a header based off of the fileinfo
 		header, err := tar.FileInfoHeader(info, "")
 		if err != nil {
@@ -265,6 +280,16 @@ func (t *TarFile) AddAll(dir string, includeCurrentFolder bool) error {
 		// Set the header's name to what we want--it may not include the top folder
 		header.Name = entryName
 
+		// A symlink has no body, the file reads its target
+		if info.Mode()&os.ModeSymlink != 0 {
+			target, err := ioutil.ReadAll(file)
+			if err != nil {
+				return err
+			}
+			header.Linkname = string(target)
+			return t.Writer.WriteHeader(header)
+		}
+
 		// Write the header into the tar file
 		if err := t.Writer.WriteHeader(header); err != nil {
 			return err
@@ -321,7 +346,7 @@ func getSubDir(dir string, rootDir string, includeCurrentFolder bool) (subDir st
 }
 
 // addAll is used to recursively go down through directories and add each file and directory to an archive, based on an ArchiveWriteFunc given to it
-func addAll(dir, rootDir string, includeCurrentFolder bool, writerFunc ArchiveWriteFunc) error {
+func addAll(dir, rootDir string, includeCurrentFolder bool, filter ArchiveFilterFunc, writerFunc ArchiveWriteFunc) error {
 	// Get a list of all entries in the directory, as []os.FileInfo
 	fileInfos, err := ioutil.ReadDir(dir)
 	if err != nil {
@@ -330,15 +355,30 @@ func addAll(dir, rootDir string, includeCurrentFolder bool, writerFunc ArchiveWr
 
 	// Loop through all entries
 	for _, info := range fileInfos {
-		if info.Name()[0] == '.' {
+		subDir := getSubDir(dir, rootDir, includeCurrentFolder)
+		entryName := path.Join(subDir, info.Name())
+		if !filter(info, entryName) {
 			continue
 		}
 		full := filepath.Join(dir, info.Name())
 
+		// Only regular files, directories and symlinks are added, opening a fifo blocks
+		mode := info.Mode()
+		symlink := mode&os.ModeSymlink != 0
+		if !mode.IsRegular() && !mode.IsDir() && !symlink {
+			continue
+		}
+
 		// If the entry is a file, get an io.Reader for it
 		var file *os.File
 		var reader io.Reader
-		if !info.IsDir() {
+		if symlink {
+			target, err := os.Readlink(full)
+			if err != nil {
+				return err
+			}
+			reader = strings.NewReader(target)
+		} else if !info.IsDir() {
 			file, err = os.Open(full)
 			if err != nil {
 				return err
@@ -347,8 +387,6 @@ func addAll(dir, rootDir string, includeCurrentFolder bool, writerFunc ArchiveWr
 		}
 
 		// Write the entry into the archive
-		subDir := getSubDir(dir, rootDir, includeCurrentFolder)
-		entryName := path.Join(subDir, info.Name())
 		if err := writerFunc(info, reader, entryName); err != nil {
 			if file != nil {
 				file.Close()
@@ -364,7 +402,9 @@ func addAll(dir, rootDir string, includeCurrentFolder bool, writerFunc ArchiveWr
 
 		// If the entry is a directory, recurse into it
 		if info.IsDir() {
-			addAll(full, rootDir, includeCurrentFolder, writerFunc)
+			if err := addAll(full, rootDir, includeCurrentFolder, filter, writerFunc); err != nil {
+				return err
+			}
 		}
 	}
 	return nil
@@ -0,0 +1,206 @@
+///////////////////////////////////////////////////////////
+// auth.go
+// resolve registry credentials from the docker config and credential helpers
+// ycyxuehan kun1.huang@outlook.com
+//////////////////////////////////////////////////////////
+
+package docker
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"github.com/docker/docker/api/types"
+)
+
+//INDEX_SERVER the key of docker hub in the docker config
+const INDEX_SERVER = "https://index.docker.io/v1/"
+
+//serverHost the host of a server address of the docker config, like "https://index.docker.io/v1/"
+func serverHost(server string)string{
+	server = strings.TrimPrefix(server, "https://")
+	server = strings.TrimPrefix(server, "http://")
+	if i := strings.Index(server, "/"); i >= 0 {
+		server = server[:i]
+	}
+	if server == "index.docker.io" || server == "registry-1.docker.io" {
+		return DEFAULT_REGISTRY
+	}
+	return server
+}
+
+//dockerConfig the auth part of ~/.docker/config.json
+type dockerConfig struct {
+	Auths map[string]types.AuthConfig `json:"auths"`
+	CredsStore string `json:"credsStore"`
+	CredHelpers map[string]string `json:"credHelpers"`
+}
+
+//AuthResolver resolve the credentials of a registry from the docker config and its credential helpers
+type AuthResolver struct {
+	//ConfigFile path of the docker config, $DOCKER_CONFIG/config.json or ~/.docker/config.json if empty
+	ConfigFile string
+}
+
+//NewAuthResolver new a resolver reading the default docker config
+func NewAuthResolver()*AuthResolver{
+	return &AuthResolver{}
+}
+
+func (a *AuthResolver)configFile()string{
+	if a.ConfigFile != "" {
+		return a.ConfigFile
+	}
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return filepath.Join(dir, "config.json")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".docker", "config.json")
+}
+
+//load read the docker config, an empty config if the file does not exist
+func (a *AuthResolver)load()(*dockerConfig, error){
+	var config dockerConfig
+	file := a.configFile()
+	if file == "" {
+		return &config, nil
+	}
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return &config, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, &config)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s error: %s", file, err.Error())
+	}
+	return &config, nil
+}
+
+//Resolve get the credentials of a registry host, nil if there are none
+func (a *AuthResolver)Resolve(server string)(*types.AuthConfig, error){
+	host := serverHost(server)
+	config, err := a.load()
+	if err != nil {
+		return nil, err
+	}
+	helper := config.CredHelpers[host]
+	if helper == "" && host == DEFAULT_REGISTRY {
+		helper = config.CredHelpers[INDEX_SERVER]
+	}
+	if helper == "" {
+		helper = config.CredsStore
+	}
+	if helper != "" {
+		return credentialHelper(helper, host)
+	}
+	for key, auth := range config.Auths {
+		if serverHost(key) != host {
+			continue
+		}
+		if auth.Auth != "" && auth.Username == "" {
+			data, err := base64.StdEncoding.DecodeString(auth.Auth)
+			if err != nil {
+				return nil, fmt.Errorf("decode auth of %s error: %s", key, err.Error())
+			}
+			parts := strings.SplitN(string(data), ":", 2)
+			if len(parts) != 2 {
+				return nil, fmt.Errorf("invalid auth of %s", key)
+			}
+			auth.Username, auth.Password = parts[0], parts[1]
+		}
+		auth.Auth = ""
+		auth.ServerAddress = host
+		return &auth, nil
+	}
+	return nil, nil
+}
+
+//ResolveImage get the credentials of the registry of an image, nil if there are none
+func (a *AuthResolver)ResolveImage(image string)(*types.AuthConfig, error){
+	ref, err := ParseReference(image)
+	if err != nil {
+		return nil, err
+	}
+	return a.Resolve(ref.Registry)
+}
+
+//credentialHelper get the credentials of a host with docker-credential-<helper>, nil if it has none
+func credentialHelper(helper string, host string)(*types.AuthConfig, error){
+	server := host
+	if host == DEFAULT_REGISTRY {
+		server = INDEX_SERVER
+	}
+	cmd := exec.Command("docker-credential-"+helper, "get")
+	cmd.Stdin = strings.NewReader(server)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	//stderr is only used in the error, stdout is the json of the credentials
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil {
+		//the helpers report errors on stdout
+		out := strings.TrimSpace(stdout.String())
+		if strings.Contains(out, "credentials not found") {
+			return nil, nil
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			out = strings.TrimSpace(out + " " + msg)
+		}
+		return nil, fmt.Errorf("docker-credential-%s error: %s %s", helper, err.Error(), out)
+	}
+	var creds struct {
+		Username string
+		Secret string
+	}
+	err = json.Unmarshal(stdout.Bytes(), &creds)
+	if err != nil {
+		return nil, fmt.Errorf("docker-credential-%s error: %s", helper, err.Error())
+	}
+	auth := types.AuthConfig{ServerAddress: host}
+	//an identity token is stored with the username <token>
+	if creds.Username == "<token>" {
+		auth.IdentityToken = creds.Secret
+	} else {
+		auth.Username = creds.Username
+		auth.Password = creds.Secret
+	}
+	return &auth, nil
+}
+
+//registryAuth the encoded auth of the registry of an image, explicit credentials are used first
+func (d *Docker)registryAuth(ref *Reference, username string, password string)(string, error){
+	host := ref.Registry
+	if username != "" && password != "" {
+		return GetAuthString(host, username, password)
+	}
+	resolver := d.Auth
+	if resolver == nil {
+		resolver = NewAuthResolver()
+	}
+	auth, err := resolver.Resolve(host)
+	if err != nil || auth == nil {
+		return "", err
+	}
+	return encodeAuth(auth)
+}
+
+//encodeAuth encode an auth config for the X-Registry-Auth header
+func encodeAuth(auth *types.AuthConfig)(string, error){
+	encodedJSON, err := json.Marshal(auth)
+	if err != nil {
+		return "", fmt.Errorf("convert login string error")
+	}
+	return base64.URLEncoding.EncodeToString(encodedJSON), nil
+}
@@ -8,7 +8,10 @@ package docker
 
 import (
 	"github.com/docker/go-connections/nat"
+	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/pkg/jsonmessage"
+	"fmt"
 	"strings"
 
 )
@@ -39,14 +42,86 @@ func GetRestartPolicy(policy string)RestartPolicy{
 
 //BuildImageOptions build image options
 type BuildImageOptions struct {
+	//File a tar of the build context, it is used if Context is empty
 	File string
+	//Context the build context directory, it is tarred on the fly
+	Context string
+	//Dockerfile path of the dockerfile, relative to Context or absolute, Dockerfile in Context if empty
+	Dockerfile string
 	Tags [] string
 	PullParenet bool
+	//BuildArgs values of the ARG instructions
+	BuildArgs map[string]string
+	//Target the stage of a multi-stage build
+	Target string
+	Labels map[string]string
+	NoCache bool
+	//CacheFrom images used as cache sources
+	CacheFrom []string
+	//NetworkMode network of the RUN instructions
+	NetworkMode string
+	//ExtraHosts hosts added to /etc/hosts, as "host:ip"
+	ExtraHosts []string
+	//Platform like "linux/arm64", the daemon platform if empty
+	Platform string
+	//BuildKit build with BuildKit, it is set if Secrets or SSH is not empty
+	BuildKit bool
+	//Secrets the files exposed to RUN --mount=type=secret, by id
+	Secrets map[string]string
+	//SSH the agent sockets or keys exposed to RUN --mount=type=ssh, by id.
+	//An empty list means the agent at SSH_AUTH_SOCK.
+	SSH map[string][]string
+	//OnMessage called with every message of the build output
+	OnMessage func(msg *jsonmessage.JSONMessage)
+	//Messages receive every message of the build output, it is not closed by BuildImage
+	Messages chan<- *jsonmessage.JSONMessage
 }
+
+//buildKit whether the build needs BuildKit
+func (b *BuildImageOptions)buildKit()bool{
+	return b.BuildKit || len(b.Secrets) > 0 || len(b.SSH) > 0
+}
+
+//buildArgs the build args of the daemon request
+func (b *BuildImageOptions)buildArgs()map[string]*string{
+	args := map[string]*string{}
+	for k, v := range b.BuildArgs {
+		value := v
+		args[k] = &value
+	}
+	return args
+}
+
+//notify forward a build message
+func (b *BuildImageOptions)notify(msg *jsonmessage.JSONMessage){
+	if b.OnMessage != nil {
+		b.OnMessage(msg)
+	}
+	if b.Messages != nil {
+		b.Messages <- msg
+	}
+}
+
 //BuildImageResponse build image response info
 type BuildImageResponse struct {
 	ImageHash string `json:"stream"`
 }
+
+//BuildError a failed build
+type BuildError struct {
+	//Step the last step started, like "Step 3/5 : RUN make"
+	Step string
+	Code int
+	Message string
+}
+
+//Error implement error
+func (e *BuildError)Error()string{
+	if e.Step == "" {
+		return fmt.Sprintf("build image error: %s", e.Message)
+	}
+	return fmt.Sprintf("build image error at %s: %s", e.Step, e.Message)
+}
 //GetImageHash get image hash
 func (b *BuildImageResponse)GetImageHash()string{
 	if b.ImageHash == "" {
@@ -75,16 +150,56 @@ type CreateContainerOptions struct {
 	PortBindings nat.PortMap
 	ExposedPorts nat.PortSet
 	ExtraHosts [] string
+	//VolumeBinds binds like "/src:/dst:ro"
 	VolumeBinds []string
 	Memory int64
 	Swappiness int64
 	OomKillDisable bool
 	RestartPolicy string
 	RestartRetryCount int
+	//Registry the registry host of Image if it has none
 	Registry string
 	RegistryUser string
 	RegistryPassword string
+	//Cmd and Entrypoint override the image ones
+	Cmd []string
+	Entrypoint []string
+	User string
+	WorkingDir string
+	Labels map[string]string
+	//Networks the networks the container joins, the first is the network mode
+	Networks []string
+	//CPUs the cpu limit, like 1.5
+	CPUs float64
+	CPUShares int64
+	//CpusetCpus the cpus the container runs on, like "0-3"
+	CpusetCpus string
+	CapAdd []string
+	CapDrop []string
+	Privileged bool
+	//Healthcheck overrides the HEALTHCHECK of the image
+	Healthcheck *container.HealthConfig
+	//LogDriver the log driver, the daemon default if empty
+	LogDriver string
+	LogOptions map[string]string
+}
+
+//image the image with the registry prepended if it has no registry host
+func (c *CreateContainerOptions)image()string{
+	if c.Registry == "" {
+		return c.Image
+	}
+	if hasRegistry(c.Image) {
+		return c.Image
+	}
+	ref, err := ParseReference(c.Image)
+	//an invalid image is kept to fail when the container is created
+	if err != nil {
+		return c.Image
+	}
+	return ref.InRegistry(c.Registry).String()
 }
+
 //NewCreateContainerOptions new a CreateContainerOption
 func NewCreateContainerOptions()*CreateContainerOptions{
 	var c CreateContainerOptions
@@ -92,5 +207,6 @@ func NewCreateContainerOptions()*CreateContainerOptions{
 	c.PortBindings = nat.PortMap{}
 	c.ExposedPorts = nat.PortSet{}
 	c.Memory = 4096000
+	c.LogDriver = "journald"
 	return &c
 }
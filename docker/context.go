@@ -0,0 +1,122 @@
+///////////////////////////////////////////////////////////
+// context.go
+// tar a build context directory on the fly
+// ycyxuehan kun1.huang@outlook.com
+//////////////////////////////////////////////////////////
+
+package docker
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"github.com/docker/docker/builder/dockerignore"
+	"github.com/docker/docker/pkg/fileutils"
+	"github.com/ycyxuehan/binglibs/archivex"
+)
+
+//DEFAULT_DOCKERFILE the dockerfile of a context if it is not set
+const DEFAULT_DOCKERFILE = "Dockerfile"
+
+//outsideDockerfile the name of a dockerfile outside the context in the tar
+const outsideDockerfile = ".dockerfile"
+
+//readDockerignore read the patterns of the .dockerignore in dir, nil if there is no such file
+func readDockerignore(dir string)([]string, error){
+	f, err := os.Open(filepath.Join(dir, ".dockerignore"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return dockerignore.ReadAll(f)
+}
+
+//tarContext tar the context dir to a pipe honoring .dockerignore, the name of the dockerfile in the tar is returned.
+//The dockerfile and .dockerignore are always sent, a dockerfile outside dir is added as .dockerfile.
+func tarContext(dir string, dockerfile string)(io.ReadCloser, string, error){
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, "", err
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, "", fmt.Errorf("open build context error: %s", err.Error())
+	}
+	if !info.IsDir() {
+		return nil, "", fmt.Errorf("build context %s is not a directory", dir)
+	}
+	if dockerfile == "" {
+		dockerfile = DEFAULT_DOCKERFILE
+	}
+	if !filepath.IsAbs(dockerfile) {
+		dockerfile = filepath.Join(dir, dockerfile)
+	}
+	if _, err := os.Stat(dockerfile); err != nil {
+		return nil, "", fmt.Errorf("open docker file error: %s", err.Error())
+	}
+	name, err := filepath.Rel(dir, dockerfile)
+	outside := err != nil || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator))
+	if outside {
+		name = outsideDockerfile
+	}
+	name = filepath.ToSlash(name)
+	patterns, err := readDockerignore(dir)
+	if err != nil {
+		return nil, "", fmt.Errorf("read .dockerignore error: %s", err.Error())
+	}
+	matcher, err := fileutils.NewPatternMatcher(patterns)
+	if err != nil {
+		return nil, "", fmt.Errorf("parse .dockerignore error: %s", err.Error())
+	}
+	filter := func(info os.FileInfo, entryName string)bool{
+		if entryName == ".dockerignore" || (!outside && entryName == name) {
+			return true
+		}
+		//the directories of the dockerfile, their other entries are still matched
+		if !outside && info.IsDir() && strings.HasPrefix(name, entryName+"/") {
+			return true
+		}
+		ignored, err := matcher.Matches(entryName)
+		if err != nil || !ignored {
+			return true
+		}
+		//an exclusion pattern may bring back a file below an ignored directory
+		return info.IsDir() && matcher.Exclusions()
+	}
+	reader, writer := io.Pipe()
+	go func(){
+		var tar archivex.TarFile
+		err := tar.CreateWriter("context.tar", writer)
+		if err == nil {
+			err = tar.AddAllFilter(dir, false, filter)
+		}
+		if err == nil && outside {
+			err = addFile(&tar, dockerfile, name)
+		}
+		if err != nil {
+			writer.CloseWithError(fmt.Errorf("tar build context error: %s", err.Error()))
+			return
+		}
+		//Close closes the pipe too
+		err = tar.Close()
+		if err != nil {
+			writer.CloseWithError(fmt.Errorf("tar build context error: %s", err.Error()))
+		}
+	}()
+	return reader, name, nil
+}
+
+//addFile add a file to a tar as name
+func addFile(tar *archivex.TarFile, file string, name string)error{
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return tar.Add(name, f, nil)
+}
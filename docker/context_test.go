@@ -0,0 +1,168 @@
+package docker
+
+import (
+	"archive/tar"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"syscall"
+	"testing"
+)
+
+//writeFiles create files below dir, a value starting with "->" is a symlink target
+func writeFiles(t *testing.T, dir string, files map[string]string){
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		var err error
+		if len(content) > 2 && content[:2] == "->" {
+			err = os.Symlink(content[2:], path)
+		} else {
+			err = os.WriteFile(path, []byte(content), 0644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+//readTar the regular files and symlinks of a tar, a symlink is "->target"
+func readTar(t *testing.T, r io.Reader)map[string]string{
+	entries := map[string]string{}
+	reader := tar.NewReader(r)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return entries
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch header.Typeflag {
+		case tar.TypeSymlink:
+			entries[header.Name] = "->" + header.Linkname
+		case tar.TypeReg:
+			data, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			entries[header.Name] = string(data)
+		}
+	}
+}
+
+func TestTarContext(t *testing.T){
+	tests := []struct {
+		name string
+		files map[string]string
+		dockerfile string
+		wantName string
+		want map[string]string
+	}{
+		{
+			name: "dockerignore",
+			files: map[string]string{
+				"Dockerfile": "FROM a",
+				".dockerignore": "*.log\nbuild\n!build/keep",
+				"app.go": "package main",
+				"debug.log": "log",
+				"build/out": "bin",
+				"build/keep": "keep",
+			},
+			wantName: "Dockerfile",
+			want: map[string]string{
+				"Dockerfile": "FROM a",
+				".dockerignore": "*.log\nbuild\n!build/keep",
+				"app.go": "package main",
+				"build/keep": "keep",
+			},
+		},
+		{
+			name: "dockerfile below an ignored directory",
+			files: map[string]string{
+				".dockerignore": "docker\n",
+				"docker/app/Dockerfile": "FROM b",
+				"docker/app/secret": "secret",
+				"main.go": "package main",
+			},
+			dockerfile: "docker/app/Dockerfile",
+			wantName: "docker/app/Dockerfile",
+			want: map[string]string{
+				".dockerignore": "docker\n",
+				"docker/app/Dockerfile": "FROM b",
+				"main.go": "package main",
+			},
+		},
+		{
+			name: "symlinks",
+			files: map[string]string{
+				"Dockerfile": "FROM c",
+				"config/app.yaml": "a: 1",
+				"app.yaml": "->config/app.yaml",
+				"dangling": "->missing",
+			},
+			wantName: "Dockerfile",
+			want: map[string]string{
+				"Dockerfile": "FROM c",
+				"config/app.yaml": "a: 1",
+				"app.yaml": "->config/app.yaml",
+				"dangling": "->missing",
+			},
+		},
+	}
+	for _, test := range tests {
+		dir := t.TempDir()
+		writeFiles(t, dir, test.files)
+		reader, name, err := tarContext(dir, test.dockerfile)
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		got := readTar(t, reader)
+		reader.Close()
+		if name != test.wantName {
+			t.Errorf("%s: dockerfile %q, want %q", test.name, name, test.wantName)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: tar %v, want %v", test.name, keys(got), keys(test.want))
+		}
+	}
+}
+
+func TestTarContextOutsideDockerfile(t *testing.T){
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"Dockerfile.prod": "FROM d",
+		"context/main.go": "package main",
+	})
+	dir := filepath.Join(root, "context")
+	//a fifo would block the tar if it was opened
+	if err := syscall.Mkfifo(filepath.Join(dir, "fifo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	reader, name, err := tarContext(dir, filepath.Join(root, "Dockerfile.prod"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	got := readTar(t, reader)
+	want := map[string]string{outsideDockerfile: "FROM d", "main.go": "package main"}
+	if name != outsideDockerfile || !reflect.DeepEqual(got, want) {
+		t.Errorf("dockerfile %q, tar %v", name, got)
+	}
+	if _, _, err := tarContext(dir, "missing"); err == nil {
+		t.Error("missing dockerfile accepted")
+	}
+}
+
+func keys(m map[string]string)[]string{
+	list := []string{}
+	for k := range m {
+		list = append(list, k)
+	}
+	sort.Strings(list)
+	return list
+}
@@ -9,11 +9,11 @@ package docker
 import (
 	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/api/types/container"
-	"encoding/base64"
 	"strings"
 	"encoding/json"
-	"io/ioutil"
+	"io"
 	"context"
+	"github.com/docker/docker/pkg/jsonmessage"
 	"github.com/docker/docker/api/types"
 	"os"
 	"fmt"
@@ -26,6 +26,8 @@ type Docker struct {
 	APIVersion string
 	header map[string]string
 	conn *client.Client
+	//Auth resolve the credentials of registries when none are given
+	Auth *AuthResolver
 }
 
 //New new a docker client
@@ -38,6 +40,7 @@ func New(URI string, version string)(*Docker, error){
 	d.APIVersion = version
 	d.header = make(map[string]string)
 	d.header["Content-Type"] = "application/tar"
+	d.Auth = NewAuthResolver()
 	err := d.connect()
 	return &d, err
 }
@@ -57,62 +60,119 @@ func (d *Docker)BuildImage(opt BuildImageOptions)(*BuildImageResponse, error){
 	if d.conn == nil {
 		return nil, fmt.Errorf("can not connect to %s", d.ConnURI)
 	}
-	if opt.File == "" {
+	var buildContext io.ReadCloser
+	dockerfile := opt.Dockerfile
+	var err error
+	switch {
+	case opt.Context != "":
+		buildContext, dockerfile, err = tarContext(opt.Context, opt.Dockerfile)
+		if err != nil {
+			return nil, err
+		}
+	case opt.File != "":
+		buildContext, err = os.Open(opt.File)
+		if err != nil {
+			return nil, fmt.Errorf("open docker file error: %s", err.Error())
+		}
+	default:
 		return nil, fmt.Errorf("no file to build an image")
 	}
-	buildContext, err := os.Open(opt.File)
-	if err != nil {
-		return nil, fmt.Errorf("open docker file error: %s", err.Error())
-	}
 	defer buildContext.Close()
 	options := types.ImageBuildOptions {
-		SuppressOutput: true,
+		Dockerfile: dockerfile,
 		Remove: true,
 		PullParent: opt.PullParenet,
 		Tags: opt.Tags,
+		BuildArgs: opt.buildArgs(),
+		Target: opt.Target,
+		Labels: opt.Labels,
+		NoCache: opt.NoCache,
+		CacheFrom: opt.CacheFrom,
+		NetworkMode: opt.NetworkMode,
+		ExtraHosts: opt.ExtraHosts,
+		Platform: opt.Platform,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if opt.buildKit() {
+		options.Version = types.BuilderBuildKit
+		s, err := d.startSession(ctx, &opt)
+		if err != nil {
+			return nil, err
+		}
+		defer s.Close()
+		options.SessionID = s.ID()
 	}
-	buildResponse, err := d.conn.ImageBuild(context.Background(), buildContext, options)
+	buildResponse, err := d.conn.ImageBuild(ctx, buildContext, options)
 	if err != nil {
 		return nil, fmt.Errorf("build image error: %s", err.Error())
 	}
 	defer buildResponse.Body.Close()
-	response, err := ioutil.ReadAll(buildResponse.Body)
-	if err != nil {
-		return nil, fmt.Errorf("build image succeessed but get image info error: %s", err.Error())
-	}
 	var bir BuildImageResponse
-	err = json.Unmarshal(response, &bir)
+	step := ""
+	err = decodeStream(buildResponse.Body, func(msg *jsonmessage.JSONMessage)error{
+		opt.notify(msg)
+		if jsonErr := messageError(msg); jsonErr != nil {
+			return &BuildError{Step: step, Code: jsonErr.Code, Message: jsonErr.Message}
+		}
+		stream := strings.TrimSpace(msg.Stream)
+		if strings.HasPrefix(stream, "Step ") {
+			step = stream
+		}
+		if strings.HasPrefix(stream, "Successfully built ") && bir.ImageHash == "" {
+			bir.ImageHash = strings.TrimPrefix(stream, "Successfully built ")
+		}
+		if msg.Aux != nil {
+			var aux struct {
+				ID string `json:"ID"`
+			}
+			if json.Unmarshal(*msg.Aux, &aux) == nil && aux.ID != "" {
+				bir.ImageHash = aux.ID
+			}
+		}
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("build image maybe failed, message: %s", string(response))
+		if _, ok := err.(*BuildError); ok {
+			return nil, err
+		}
+		return nil, fmt.Errorf("decode build output error: %s", err.Error())
+	}
+	if bir.ImageHash == "" {
+		return nil, &BuildError{Step: step, Message: "no image id in the build output"}
 	}
 	return &bir, nil
 }
 
-//PushImage push an image
+//PushImage push an image, the statuses of the push are returned
 func (d *Docker)PushImage(image string, user string, passwd string)([]string, error){
+	return d.PushImageWithProgress(image, user, passwd, nil)
+}
+
+//PushImageWithProgress push an image and report the progress of every layer to fn
+func (d *Docker)PushImageWithProgress(image string, user string, passwd string, fn ProgressFunc)([]string, error){
 	if image == "" {
 		return []string{}, fmt.Errorf("image tag is empty")
 	}
 	if d.conn == nil {
 		return []string{}, fmt.Errorf("can not connect to %s", d.ConnURI)
 	}
-	opt := types.ImagePushOptions{}
-	tags := strings.Split(image, "/")
-	if len(tags) > 1 && user != "" && passwd != ""{
-		authStr, err := GetAuthString(tags[0], user, passwd)
-		if err != nil {
-			return []string{}, fmt.Errorf("get auth string error")
-		}
-		opt.RegistryAuth = authStr
+	ref, err := ParseReference(image)
+	if err != nil {
+		return []string{}, err
 	}
+	authStr, err := d.registryAuth(ref, user, passwd)
+	if err != nil {
+		return []string{}, fmt.Errorf("get auth string error: %s", err.Error())
+	}
+	opt := types.ImagePushOptions{RegistryAuth: authStr}
 	ctx := context.Background()
-	out, err := d.conn.ImagePush(ctx, image, opt)
+	out, err := d.conn.ImagePush(ctx, ref.String(), opt)
 	if err != nil {
 		return []string{}, err
 	}
 	defer out.Close()
-	data, err := ioutil.ReadAll(out)
-	return strings.Split(string(data), "\n"), nil
+	return decodeProgress(out, "push", ref.String(), fn)
 }
 
 //GetContainer get a container
@@ -207,44 +267,79 @@ func (d *Docker)UpdateContainer(ID string, opt UpdateOptions)error {
 //CreateContainer Create a container
 func (d *Docker)CreateContainer(opt *CreateContainerOptions)(string, error){
 	var body container.ContainerCreateCreatedBody
-	d.PullImage(opt.Image, opt.RegistryUser, opt.RegistryPassword)
+	image := opt.image()
+	d.PullImage(image, opt.RegistryUser, opt.RegistryPassword)
 	ctx := context.Background()
+	conf, hostConf := containerConfig(opt)
+	//checkout volume src
+	checkoutVolume(opt.Mounts)
+	body, err := d.conn.ContainerCreate(ctx, conf, hostConf, nil, opt.Name)
+	if err != nil{		
+		return "", fmt.Errorf("create container error: %s", err.Error())
+	}
+	//only one network can be joined at creation
+	for i := 1; i < len(opt.Networks); i++ {
+		err = d.conn.NetworkConnect(ctx, opt.Networks[i], body.ID, nil)
+		if err != nil {
+			d.RemoveContainer(body.ID, true)
+			return "", fmt.Errorf("connect container to network %s error: %s", opt.Networks[i], err.Error())
+		}
+	}
+	return body.ID, nil
+}
+
+//containerConfig the configs of the daemon to create a container
+func containerConfig(opt *CreateContainerOptions)(*container.Config, *container.HostConfig){
 	var conf container.Config
-	conf.Image = opt.Image
+	conf.Image = opt.image()
 	conf.Env = opt.Env
 	conf.Hostname = opt.HostName
 	conf.AttachStdout = true
 	conf.AttachStderr = true
+	conf.Cmd = opt.Cmd
+	conf.Entrypoint = opt.Entrypoint
+	conf.User = opt.User
+	conf.WorkingDir = opt.WorkingDir
+	conf.Labels = opt.Labels
+	conf.Healthcheck = opt.Healthcheck
 	
 	var hostConf container.HostConfig
 	//volumes
 	hostConf.Mounts = opt.Mounts
-	//checkout volume src
-	checkoutVolume(opt.Mounts)
+	hostConf.Binds = opt.VolumeBinds
 	//expose
 	hostConf.PortBindings = opt.PortBindings
-	hostConf.LogConfig.Type = "journald"
+	hostConf.LogConfig.Type = opt.LogDriver
+	hostConf.LogConfig.Config = opt.LogOptions
 	hostConf.IpcMode = ""
 	// hostConf.Runtime = "docker-runc"
 	hostConf.Devices = []container.DeviceMapping{}
 	conf.ExposedPorts = opt.ExposedPorts
-	// hostConf.Binds = opt.VolumeBinds
 	//hosts
 	hostConf.ExtraHosts = opt.ExtraHosts
+	//security
+	hostConf.Privileged = opt.Privileged
+	hostConf.CapAdd = opt.CapAdd
+	hostConf.CapDrop = opt.CapDrop
 	//resource
 	hostConf.Memory = opt.Memory
 	hostConf.OomKillDisable = &opt.OomKillDisable
 	hostConf.MemorySwappiness = &opt.Swappiness
-	hostConf.MemorySwap = opt.Memory + 1
+	if opt.Memory > 0 {
+		hostConf.MemorySwap = opt.Memory + 1
+	}
+	hostConf.NanoCPUs = int64(opt.CPUs * 1e9)
+	hostConf.CPUShares = opt.CPUShares
+	hostConf.CpusetCpus = opt.CpusetCpus
 	hostConf.RestartPolicy = container.RestartPolicy{Name:opt.RestartPolicy,}
 		if hostConf.RestartPolicy.IsOnFailure(){
 		hostConf.RestartPolicy.MaximumRetryCount = opt.RestartRetryCount
 	}
-	body, err := d.conn.ContainerCreate(ctx, &conf, &hostConf, nil, opt.Name)
-	if err != nil{		
-		return "", fmt.Errorf("create container error: %s", err.Error())
+	//networks
+	if len(opt.Networks) > 0 {
+		hostConf.NetworkMode = container.NetworkMode(opt.Networks[0])
 	}
-	return body.ID, nil
+	return &conf, &hostConf
 }
 
 //GetContainerByID get container by id
@@ -273,7 +368,7 @@ func (d *Docker)GetContainerByImage(img string, all bool)(*types.Container, erro
 		return nil, err
 	}
 	for _, c := range containers {
-		if c.Image == img  {
+		if SameImage(c.Image, img) || c.ImageID == img {
 			return &c, nil
 		}
 	}
@@ -305,32 +400,47 @@ func checkoutVolume(mounts []mount.Mount){
 	}
 }
 
-//Tag tag an image
+//Tag tag an image, old is an image reference or ID
 func (d *Docker)Tag(old string, new string)error{
-	err := d.conn.ImageTag(context.Background(), old, new)
+	ref, err := ParseReference(new)
+	if err != nil {
+		return err
+	}
+	if ref.Digest != "" {
+		return fmt.Errorf("can not tag an image as a digest %s", new)
+	}
+	err = d.conn.ImageTag(context.Background(), old, ref.String())
 	return err 
 }
 
-//Pull pull an image
+//PullImage pull an image, the statuses of the pull are returned
 func (d *Docker)PullImage(tag string, username string, password string)([]string, error){
-	pullOpt := types.ImagePullOptions{}
-	tags := strings.Split(tag, "/")
-	if len(tags) > 1 && username != "" && password != ""{
-		authStr, err := GetAuthString(tags[0], username, password)
-		if err != nil {
-			return []string{}, fmt.Errorf("get auth string error")
-		}
-		pullOpt.RegistryAuth = authStr
+	return d.PullImageWithProgress(tag, username, password, nil)
+}
+
+//PullImageWithProgress pull an image and report the progress of every layer to fn
+func (d *Docker)PullImageWithProgress(tag string, username string, password string, fn ProgressFunc)([]string, error){
+	if d.conn == nil {
+		return []string{}, fmt.Errorf("can not connect to %s", d.ConnURI)
 	}
-	response, err := d.conn.ImagePull(context.Background(), tag,  pullOpt)
+	ref, err := ParseReference(tag)
+	if err != nil {
+		return []string{}, err
+	}
+	authStr, err := d.registryAuth(ref, username, password)
+	if err != nil {
+		return []string{}, fmt.Errorf("get auth string error: %s", err.Error())
+	}
+	pullOpt := types.ImagePullOptions{RegistryAuth: authStr}
+	response, err := d.conn.ImagePull(context.Background(), ref.String(),  pullOpt)
 	if err != nil {
 		return []string{}, err
 	}
 	defer response.Close()
-	data, err := ioutil.ReadAll(response)
-	return strings.Split(string(data), "\n"), nil
+	return decodeProgress(response, "pull", ref.String(), fn)
 }
 
+//GetAuthString encode the credentials of a registry host for the daemon
 func GetAuthString(server string, username string, password string)(string, error){
 	if server == "" {
 		return "", nil
@@ -339,10 +449,5 @@ func GetAuthString(server string, username string, password string)(string, erro
 	authConf.Username = username
 	authConf.Password = password
 	authConf.ServerAddress = server
-	encodedJSON, err := json.Marshal(authConf)
-	if err != nil {
-		return "", fmt.Errorf("convert login string error")
-	}
-	authStr := base64.URLEncoding.EncodeToString(encodedJSON)
-	return authStr, nil
+	return encodeAuth(&authConf)
 }
\ No newline at end of file
@@ -0,0 +1,307 @@
+///////////////////////////////////////////////////////////
+// ensure.go
+// reconcile a named container with its desired options
+// ycyxuehan kun1.huang@outlook.com
+//////////////////////////////////////////////////////////
+
+package docker
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/docker/go-connections/nat"
+)
+
+//DEFAULT_READY_TIMEOUT how long Ensure waits for a new container to be ready
+const DEFAULT_READY_TIMEOUT = time.Minute
+
+//the actions of Ensure
+const (
+	ENSURE_UNCHANGED = "unchanged"
+	ENSURE_STARTED = "started"
+	ENSURE_CREATED = "created"
+	ENSURE_RECREATED = "recreated"
+)
+
+//EnsureOptions the desired container of Ensure
+type EnsureOptions struct {
+	//Container the desired options, Name is required
+	Container *CreateContainerOptions
+	//BlueGreen start the new container before the old one is removed, the old one is kept if the new one is not ready.
+	//The new container runs next to the old one unless it publishes host ports, then the old one is stopped first.
+	BlueGreen bool
+	//Ready the conditions of a ready container, Healthy if it has a healthcheck or Running
+	Ready []Condition
+	//Timeout of waiting for the new container to be ready, DEFAULT_READY_TIMEOUT if zero
+	Timeout time.Duration
+}
+
+//EnsureResult what Ensure did
+type EnsureResult struct {
+	ID string
+	//Action ENSURE_UNCHANGED, ENSURE_STARTED, ENSURE_CREATED or ENSURE_RECREATED
+	Action string
+	//Diff the differences causing the container to be recreated
+	Diff []string
+}
+
+//Ensure make the container named opt.Container.Name match the options, it is recreated only if it differs
+func (d *Docker)Ensure(opt EnsureOptions)(*EnsureResult, error){
+	desired := opt.Container
+	if desired == nil || desired.Name == "" {
+		return nil, fmt.Errorf("container name is empty")
+	}
+	if d.conn == nil {
+		return nil, fmt.Errorf("can not connect to %s", d.ConnURI)
+	}
+	ctx := context.Background()
+	d.PullImage(desired.image(), desired.RegistryUser, desired.RegistryPassword)
+	image, _, err := d.conn.ImageInspectWithRaw(ctx, desired.image())
+	if err != nil {
+		return nil, fmt.Errorf("inspect image %s error: %s", desired.image(), err.Error())
+	}
+	current, err := d.conn.ContainerInspect(ctx, desired.Name)
+	if client.IsErrNotFound(err) {
+		ID, err := d.createReady(desired, &image, &opt)
+		if err != nil {
+			return nil, err
+		}
+		return &EnsureResult{ID: ID, Action: ENSURE_CREATED}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("inspect container %s error: %s", desired.Name, err.Error())
+	}
+	result := &EnsureResult{ID: current.ID, Action: ENSURE_UNCHANGED}
+	result.Diff = diffContainer(&current, &image, desired)
+	if len(result.Diff) == 0 {
+		if current.State != nil && !current.State.Running {
+			err = d.StartContainer(current.ID)
+			if err != nil {
+				return result, fmt.Errorf("start container %s error: %s", desired.Name, err.Error())
+			}
+			result.Action = ENSURE_STARTED
+		}
+		return result, nil
+	}
+	result.Action = ENSURE_RECREATED
+	if opt.BlueGreen {
+		result.ID, err = d.swap(&current, desired, &image, &opt)
+		return result, err
+	}
+	d.StopContainer(current.ID)
+	err = d.RemoveContainer(current.ID, true)
+	if err != nil {
+		return result, fmt.Errorf("remove container %s error: %s", desired.Name, err.Error())
+	}
+	result.ID, err = d.createReady(desired, &image, &opt)
+	return result, err
+}
+
+//createReady create and start a container and wait for it to be ready, the ID is returned even if it is not ready
+func (d *Docker)createReady(desired *CreateContainerOptions, image *types.ImageInspect, opt *EnsureOptions)(string, error){
+	ID, err := d.CreateContainer(desired)
+	if err != nil {
+		return "", err
+	}
+	err = d.StartContainer(ID)
+	if err != nil {
+		return ID, fmt.Errorf("start container %s error: %s", desired.Name, err.Error())
+	}
+	timeout := opt.Timeout
+	if timeout <= 0 {
+		timeout = DEFAULT_READY_TIMEOUT
+	}
+	conditions := opt.Ready
+	if len(conditions) == 0 {
+		conditions = []Condition{Running()}
+		if hasHealthcheck(desired, image) {
+			conditions = []Condition{Healthy()}
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return ID, d.WaitFor(ctx, ID, conditions...)
+}
+
+//swap replace the current container with a ready new one, the current one is restored if the new one is not ready
+func (d *Docker)swap(current *types.ContainerJSON, desired *CreateContainerOptions, image *types.ImageInspect, opt *EnsureOptions)(string, error){
+	ctx := context.Background()
+	name := desired.Name
+	next := *desired
+	if publishesHostPorts(desired) {
+		//the host ports are released by the current container first
+		previous := name + "-previous"
+		err := d.conn.ContainerRename(ctx, current.ID, previous)
+		if err != nil {
+			return current.ID, fmt.Errorf("rename container %s error: %s", name, err.Error())
+		}
+		d.StopContainer(current.ID)
+		ID, err := d.createReady(&next, image, opt)
+		if err != nil {
+			if ID != "" {
+				d.RemoveContainer(ID, true)
+			}
+			d.conn.ContainerRename(ctx, current.ID, name)
+			if startErr := d.StartContainer(current.ID); startErr != nil {
+				return current.ID, fmt.Errorf("%s, and rollback failed: %s", err.Error(), startErr.Error())
+			}
+			return current.ID, fmt.Errorf("%s, rolled back to %s", err.Error(), current.ID)
+		}
+		d.RemoveContainer(current.ID, true)
+		return ID, nil
+	}
+	next.Name = name + "-next"
+	ID, err := d.createReady(&next, image, opt)
+	if err != nil {
+		if ID != "" {
+			d.RemoveContainer(ID, true)
+		}
+		return current.ID, fmt.Errorf("%s, kept %s", err.Error(), current.ID)
+	}
+	d.StopContainer(current.ID)
+	err = d.RemoveContainer(current.ID, true)
+	if err != nil {
+		return ID, fmt.Errorf("remove container %s error: %s", name, err.Error())
+	}
+	err = d.conn.ContainerRename(ctx, ID, name)
+	if err != nil {
+		return ID, fmt.Errorf("rename container %s error: %s", next.Name, err.Error())
+	}
+	return ID, nil
+}
+
+//publishesHostPorts whether the container binds ports of the host
+func publishesHostPorts(opt *CreateContainerOptions)bool{
+	for _, bindings := range opt.PortBindings {
+		for _, binding := range bindings {
+			if binding.HostPort != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//hasHealthcheck whether the container has a healthcheck from its options or image
+func hasHealthcheck(opt *CreateContainerOptions, image *types.ImageInspect)bool{
+	check := opt.Healthcheck
+	if check == nil && image.Config != nil {
+		check = image.Config.Healthcheck
+	}
+	return check != nil && len(check.Test) > 0 && check.Test[0] != "NONE"
+}
+
+//diffContainer the differences between a container and its desired options, the image fills the defaults
+func diffContainer(current *types.ContainerJSON, image *types.ImageInspect, desired *CreateContainerOptions)[]string{
+	diff := []string{}
+	add := func(field string, have interface{}, want interface{}){
+		if !reflect.DeepEqual(have, want) {
+			diff = append(diff, fmt.Sprintf("%s: %v != %v", field, have, want))
+		}
+	}
+	add("image", current.Image, image.ID)
+	if current.Config != nil {
+		var imageEnv []string
+		imageLabels := map[string]string{}
+		if image.Config != nil {
+			imageEnv = image.Config.Env
+			for k, v := range image.Config.Labels {
+				imageLabels[k] = v
+			}
+		}
+		add("env", sorted(current.Config.Env), sorted(mergeEnv(imageEnv, desired.Env)))
+		for k, v := range desired.Labels {
+			imageLabels[k] = v
+		}
+		add("labels", nonNil(current.Config.Labels), imageLabels)
+		if len(desired.Cmd) > 0 {
+			add("cmd", []string(current.Config.Cmd), desired.Cmd)
+		}
+		if len(desired.Entrypoint) > 0 {
+			add("entrypoint", []string(current.Config.Entrypoint), desired.Entrypoint)
+		}
+		if desired.User != "" {
+			add("user", current.Config.User, desired.User)
+		}
+		if desired.WorkingDir != "" {
+			add("working dir", current.Config.WorkingDir, desired.WorkingDir)
+		}
+	}
+	if host := current.HostConfig; host != nil {
+		mounts := []string{}
+		for _, m := range host.Mounts {
+			mounts = append(mounts, fmt.Sprintf("%s:%s:%s:%t", m.Type, m.Source, m.Target, m.ReadOnly))
+		}
+		want := []string{}
+		for _, m := range desired.Mounts {
+			want = append(want, fmt.Sprintf("%s:%s:%s:%t", m.Type, m.Source, m.Target, m.ReadOnly))
+		}
+		add("mounts", sorted(mounts), sorted(want))
+		add("binds", sorted(host.Binds), sorted(desired.VolumeBinds))
+		add("ports", portBindings(host.PortBindings), portBindings(desired.PortBindings))
+		add("memory", host.Memory, desired.Memory)
+		add("cpus", host.NanoCPUs, int64(desired.CPUs * 1e9))
+		add("cpu shares", host.CPUShares, desired.CPUShares)
+		add("cpuset", host.CpusetCpus, desired.CpusetCpus)
+		add("privileged", host.Privileged, desired.Privileged)
+		add("restart policy", restartPolicy(host.RestartPolicy.Name), restartPolicy(desired.RestartPolicy))
+	}
+	return diff
+}
+
+//restartPolicy an empty policy is no
+func restartPolicy(name string)string{
+	if name == "" {
+		return string(No)
+	}
+	return name
+}
+
+//mergeEnv the env of the image overridden by env
+func mergeEnv(base []string, env []string)[]string{
+	keys := map[string]int{}
+	merged := []string{}
+	for _, list := range [][]string{base, env} {
+		for _, kv := range list {
+			key := strings.SplitN(kv, "=", 2)[0]
+			if i, ok := keys[key]; ok {
+				merged[i] = kv
+				continue
+			}
+			keys[key] = len(merged)
+			merged = append(merged, kv)
+		}
+	}
+	return merged
+}
+
+//portBindings the bindings as sorted strings, like "80/tcp->0.0.0.0:8080"
+func portBindings(ports nat.PortMap)[]string{
+	bindings := []string{}
+	for port, list := range ports {
+		for _, binding := range list {
+			bindings = append(bindings, fmt.Sprintf("%s->%s:%s", port, binding.HostIP, binding.HostPort))
+		}
+	}
+	return sorted(bindings)
+}
+
+//sorted a sorted copy, never nil
+func sorted(list []string)[]string{
+	s := append([]string{}, list...)
+	sort.Strings(s)
+	return s
+}
+
+func nonNil(m map[string]string)map[string]string{
+	if m == nil {
+		return map[string]string{}
+	}
+	return m
+}
@@ -0,0 +1,215 @@
+///////////////////////////////////////////////////////////
+// events.go
+// subscribe the event stream of the daemon
+// ycyxuehan kun1.huang@outlook.com
+//////////////////////////////////////////////////////////
+
+package docker
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+)
+
+//MAX_RECONNECT_DELAY the longest delay before reconnecting to the event stream
+const MAX_RECONNECT_DELAY = 30 * time.Second
+
+//Event an event of the daemon
+type Event struct {
+	//Type container, image, network, volume, daemon...
+	Type string
+	//Action like die, oom, push or "health_status: healthy"
+	Action string
+	//ID the id of the container, network or volume, or the name of the image
+	ID string
+	//Attributes like the name, image and labels of a container
+	Attributes map[string]string
+	Time time.Time
+}
+
+//EventsOptions which events to subscribe, the filters of a kind are ORed and the kinds are ANDed
+type EventsOptions struct {
+	Types []string
+	//Containers container IDs or names
+	Containers []string
+	//Labels "key" or "key=value"
+	Labels []string
+	Images []string
+	//Actions like die or health_status, an action matches the actions with its prefix and a colon too
+	Actions []string
+	//Since replay the events after it, zero means from now
+	Since time.Time
+	//OnError called when the stream fails before it is reconnected
+	OnError func(err error)
+}
+
+//filters the filters sent to the daemon, actions are matched by the subscription
+func (o *EventsOptions)filters()filters.Args{
+	args := filters.NewArgs()
+	for _, t := range o.Types {
+		args.Add("type", t)
+	}
+	for _, c := range o.Containers {
+		args.Add("container", c)
+	}
+	for _, l := range o.Labels {
+		args.Add("label", l)
+	}
+	for _, i := range o.Images {
+		args.Add("image", i)
+	}
+	return args
+}
+
+//matchAction whether an action is subscribed
+func (o *EventsOptions)matchAction(action string)bool{
+	if len(o.Actions) == 0 {
+		return true
+	}
+	for _, a := range o.Actions {
+		if action == a || strings.HasPrefix(action, a+":") {
+			return true
+		}
+	}
+	return false
+}
+
+//EventSubscription a subscription of the event stream, C is closed when it ends
+type EventSubscription struct {
+	C <-chan Event
+	cancel context.CancelFunc
+	mu sync.Mutex
+	last time.Time
+	//seen the events received at last, empty before the first event.
+	//The stream is resumed from last and sends them again.
+	seen map[string]bool
+}
+
+//Unsubscribe stop the subscription
+func (s *EventSubscription)Unsubscribe(){
+	s.cancel()
+}
+
+//Last the time of the last event received, or of the subscription if none is received
+func (s *EventSubscription)Last()time.Time{
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.last
+}
+
+//record remember an event, false is returned if it was received before
+func (s *EventSubscription)record(event Event)bool{
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.seen) > 0 && event.Time.Before(s.last) {
+		return false
+	}
+	//last is the subscription time before the first event, the clock of the daemon may differ
+	if len(s.seen) == 0 || event.Time.After(s.last) {
+		s.last = event.Time
+		s.seen = map[string]bool{}
+	}
+	key := event.Type + " " + event.ID + " " + event.Action
+	if s.seen[key] {
+		return false
+	}
+	s.seen[key] = true
+	return true
+}
+
+//SubscribeEvents subscribe the events of the daemon until ctx is done or it is unsubscribed.
+//The stream is reconnected when it fails and resumed from the last event received.
+func (d *Docker)SubscribeEvents(ctx context.Context, opt EventsOptions)*EventSubscription{
+	ctx, cancel := context.WithCancel(ctx)
+	c := make(chan Event)
+	since := opt.Since
+	if since.IsZero() {
+		//a reconnect before the first event resumes from now
+		since = time.Now()
+	}
+	sub := &EventSubscription{C: c, cancel: cancel, last: since, seen: map[string]bool{}}
+	go func(){
+		defer close(c)
+		delay := time.Second
+		//the first stream starts from now on the clock of the daemon if Since is not set
+		resume := !opt.Since.IsZero()
+		for ctx.Err() == nil {
+			received, err := d.streamEvents(ctx, &opt, resume, sub, c)
+			resume = true
+			if ctx.Err() != nil {
+				return
+			}
+			if opt.OnError != nil && err != nil {
+				opt.OnError(err)
+			}
+			if received {
+				delay = time.Second
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+			delay *= 2
+			if delay > MAX_RECONNECT_DELAY {
+				delay = MAX_RECONNECT_DELAY
+			}
+		}
+	}()
+	return sub
+}
+
+//streamEvents read the event stream once from the last event if resume is true, whether an event was received is returned
+func (d *Docker)streamEvents(ctx context.Context, opt *EventsOptions, resume bool, sub *EventSubscription, c chan<- Event)(bool, error){
+	options := types.EventsOptions{Filters: opt.filters()}
+	if resume {
+		options.Since = apiTime(sub.Last())
+	}
+	messages, errs := d.conn.Events(ctx, options)
+	received := false
+	for {
+		select {
+		case msg := <-messages:
+			received = true
+			event := toEvent(msg)
+			//the events at the resumed time may be sent again
+			if !sub.record(event) || !opt.matchAction(event.Action) {
+				continue
+			}
+			select {
+			case c <- event:
+			case <-ctx.Done():
+				return received, ctx.Err()
+			}
+		case err := <-errs:
+			return received, err
+		}
+	}
+}
+
+//toEvent convert a message of the daemon
+func toEvent(msg events.Message)Event{
+	event := Event{
+		Type: msg.Type,
+		Action: msg.Action,
+		ID: msg.Actor.ID,
+		Attributes: msg.Actor.Attributes,
+	}
+	if event.Action == "" {
+		event.Action = msg.Status
+	}
+	if event.ID == "" {
+		event.ID = msg.ID
+	}
+	if msg.TimeNano != 0 {
+		event.Time = time.Unix(0, msg.TimeNano)
+	} else {
+		event.Time = time.Unix(msg.Time, 0)
+	}
+	return event
+}
@@ -0,0 +1,134 @@
+///////////////////////////////////////////////////////////
+// exec.go
+// run commands in a running container
+// ycyxuehan kun1.huang@outlook.com
+//////////////////////////////////////////////////////////
+
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+//ExecOptions how to run a command with Exec
+type ExecOptions struct {
+	Env []string
+	//User the user the command runs as, the container user if empty
+	User string
+	//WorkingDir the working dir of the command, the container working dir if empty
+	WorkingDir string
+	//Tty run the command in a tty, stdout and stderr are both written to Stdout
+	Tty bool
+	Privileged bool
+	//Stdin the input of the command, it is closed for the command at EOF
+	Stdin io.Reader
+	//Stdout and Stderr receive the output of the command, it is discarded if they are nil
+	Stdout io.Writer
+	Stderr io.Writer
+	//Timeout kill the stream of the command after it, zero means no timeout
+	Timeout time.Duration
+}
+
+//Exec run a command in a running container and wait for it, the exit code of the command is returned
+func (d *Docker)Exec(ID string, cmd []string, opt ExecOptions)(int, error){
+	if ID == "" {
+		return -1, fmt.Errorf("container ID is empty")
+	}
+	if len(cmd) == 0 {
+		return -1, fmt.Errorf("command is empty")
+	}
+	if d.conn == nil {
+		return -1, fmt.Errorf("can not connect to %s", d.ConnURI)
+	}
+	ctx := context.Background()
+	if opt.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opt.Timeout)
+		defer cancel()
+	}
+	config := types.ExecConfig{
+		User: opt.User,
+		Privileged: opt.Privileged,
+		Tty: opt.Tty,
+		AttachStdin: opt.Stdin != nil,
+		AttachStdout: true,
+		AttachStderr: true,
+		Env: opt.Env,
+		WorkingDir: opt.WorkingDir,
+		Cmd: cmd,
+	}
+	execID, hijacked, err := d.startExec(ctx, ID, config)
+	if err != nil {
+		return -1, err
+	}
+	defer hijacked.Close()
+	if opt.Stdin != nil {
+		go func(){
+			io.Copy(hijacked.Conn, opt.Stdin)
+			hijacked.CloseWrite()
+		}()
+	}
+	stdout, stderr := opt.Stdout, opt.Stderr
+	if stdout == nil {
+		stdout = ioutil.Discard
+	}
+	if stderr == nil {
+		stderr = ioutil.Discard
+	}
+	copied := make(chan error, 1)
+	go func(){
+		var err error
+		if opt.Tty {
+			_, err = io.Copy(stdout, hijacked.Reader)
+		} else {
+			_, err = stdcopy.StdCopy(stdout, stderr, hijacked.Reader)
+		}
+		copied <- err
+	}()
+	select {
+	case err = <-copied:
+	case <-ctx.Done():
+		hijacked.Close()
+		return -1, fmt.Errorf("exec %s error: %s", execID, ctx.Err().Error())
+	}
+	if err != nil {
+		return -1, fmt.Errorf("read exec output error: %s", err.Error())
+	}
+	return d.waitExec(execID)
+}
+
+//startExec create an exec in a container and attach to its streams
+func (d *Docker)startExec(ctx context.Context, container string, config types.ExecConfig)(string, types.HijackedResponse, error){
+	created, err := d.conn.ContainerExecCreate(ctx, container, config)
+	if err != nil {
+		return "", types.HijackedResponse{}, fmt.Errorf("create exec error: %s", err.Error())
+	}
+	hijacked, err := d.conn.ContainerExecAttach(ctx, created.ID, types.ExecStartCheck{Tty: config.Tty})
+	if err != nil {
+		return "", types.HijackedResponse{}, fmt.Errorf("attach exec error: %s", err.Error())
+	}
+	return created.ID, hijacked, nil
+}
+
+//waitExec get the exit code of an exec whose streams are closed, it may still be running for a moment
+func (d *Docker)waitExec(ID string)(int, error){
+	for i := 0; ; i++ {
+		inspect, err := d.conn.ContainerExecInspect(context.Background(), ID)
+		if err != nil {
+			return -1, fmt.Errorf("inspect exec error: %s", err.Error())
+		}
+		if !inspect.Running {
+			return inspect.ExitCode, nil
+		}
+		if i >= 50 {
+			return -1, fmt.Errorf("exec %s is still running after its streams are closed", ID)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
@@ -0,0 +1,323 @@
+///////////////////////////////////////////////////////////
+// executor.go
+// execute shell commands in a container
+// ycyxuehan kun1.huang@outlook.com
+//////////////////////////////////////////////////////////
+
+package docker
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/ycyxuehan/binglibs/shell"
+)
+
+//keepAlive the command of a container created by an image executor
+const keepAlive = "trap 'exit 0' TERM; while :; do sleep 3600 & wait; done"
+
+//Executor run shell commands in a container with docker exec, it implements shell.Executor
+type Executor struct {
+	docker *Docker
+	mu sync.Mutex
+	image string
+	//Container the ID or name of the container the commands run in
+	Container string
+	//User the user the commands run as, the container user if empty
+	User string
+}
+
+//NewExecutor new an executor running commands in a running container
+func (d *Docker)NewExecutor(container string)*Executor{
+	return &Executor{docker: d, Container: container}
+}
+
+//NewImageExecutor new an executor running commands in a container created from an image.
+//The container is created and started by the first command and removed by Close.
+func (d *Docker)NewImageExecutor(image string)*Executor{
+	return &Executor{docker: d, image: image}
+}
+
+//container the container the commands run in, it is created for an image executor
+func (e *Executor)container(ctx context.Context)(string, error){
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.Container != "" {
+		return e.Container, nil
+	}
+	if e.image == "" {
+		return "", fmt.Errorf("container is empty")
+	}
+	d := e.docker
+	if d.conn == nil {
+		return "", fmt.Errorf("can not connect to %s", d.ConnURI)
+	}
+	d.PullImage(e.image, "", "")
+	conf := container.Config{
+		Image: e.image,
+		Entrypoint: []string{"/bin/sh", "-c", keepAlive},
+	}
+	body, err := d.conn.ContainerCreate(ctx, &conf, &container.HostConfig{}, nil, "")
+	if err != nil {
+		return "", fmt.Errorf("create container error: %s", err.Error())
+	}
+	err = d.conn.ContainerStart(ctx, body.ID, types.ContainerStartOptions{})
+	if err != nil {
+		d.RemoveContainer(body.ID, true)
+		return "", fmt.Errorf("start container error: %s", err.Error())
+	}
+	e.Container = body.ID
+	return e.Container, nil
+}
+
+//Close remove the container created by an image executor
+func (e *Executor)Close()error{
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.image == "" || e.Container == "" {
+		return nil
+	}
+	err := e.docker.RemoveContainer(e.Container, true)
+	e.Container = ""
+	return err
+}
+
+//Start implement shell.Executor
+func (e *Executor)Start(ctx context.Context, cmd *shell.Command)(shell.Process, error){
+	if e.docker.conn == nil {
+		return nil, fmt.Errorf("can not connect to %s", e.docker.ConnURI)
+	}
+	if cmd.Limits != nil && cmd.Limits.HasCgroup() {
+		return nil, fmt.Errorf("cgroup limits are not supported by docker exec, set them on the container")
+	}
+	id, err := e.container(ctx)
+	if err != nil {
+		return nil, err
+	}
+	path, args := cmd.Path, cmd.Args
+	if cmd.Limits != nil {
+		path, args = cmd.Limits.Wrap(path, args)
+	}
+	//print the pid first, so the process group can be killed
+	argv := shell.GroupArgv(path, args, cmd.PTY)
+	env := cmd.Env
+	switch cmd.EnvMode {
+	case shell.ENV_INHERIT:
+		env = nil
+	case shell.ENV_REPLACE:
+		argv = append(append([]string{"env", "-i"}, env...), argv...)
+		env = nil
+	}
+	config := types.ExecConfig{
+		User: e.User,
+		Tty: cmd.PTY,
+		AttachStdin: cmd.Stdin != nil,
+		AttachStdout: true,
+		AttachStderr: true,
+		Env: env,
+		WorkingDir: cmd.Dir,
+		Cmd: argv,
+	}
+	execID, hijacked, err := e.docker.startExec(ctx, id, config)
+	if err != nil {
+		return nil, err
+	}
+	p := &execProcess{
+		executor: e,
+		container: id,
+		ID: execID,
+		hijacked: hijacked,
+		tty: cmd.PTY,
+		copied: make(chan struct{}),
+	}
+	stdoutReader, stdoutWriter := io.Pipe()
+	stderrReader, stderrWriter := io.Pipe()
+	//stderr is held back until the pid is read from stdout
+	stderrPending := &pendingWriter{w: stderrWriter}
+	go func(){
+		var err error
+		if cmd.PTY {
+			_, err = io.Copy(stdoutWriter, hijacked.Reader)
+		} else {
+			_, err = stdcopy.StdCopy(stdoutWriter, stderrPending, hijacked.Reader)
+		}
+		stdoutWriter.CloseWithError(err)
+		stderrPending.flush()
+		stderrWriter.CloseWithError(err)
+		close(p.copied)
+	}()
+	stdout := bufio.NewReader(stdoutReader)
+	line, err := stdout.ReadString('\n')
+	pid, pidErr := strconv.Atoi(strings.TrimSpace(line))
+	if err != nil || pidErr != nil {
+		hijacked.Close()
+		stdoutReader.Close()
+		stderrReader.Close()
+		if err == nil || err == io.EOF {
+			err = fmt.Errorf("get pid error: %q %s", line, strings.TrimSpace(stderrPending.String()))
+		}
+		return nil, fmt.Errorf("start exec error: %s", err.Error())
+	}
+	stderrPending.release()
+	p.pid = pid
+	p.stdout = stdout
+	if !cmd.PTY {
+		p.stderr = stderrReader
+	} else {
+		p.Resize(cmd.WindowSize)
+	}
+	if cmd.Stdin != nil {
+		go func(){
+			io.Copy(hijacked.Conn, cmd.Stdin)
+			hijacked.CloseWrite()
+		}()
+	}
+	go func(){
+		select {
+		case <-ctx.Done():
+			p.killGroup()
+			hijacked.Close()
+		case <-p.copied:
+		}
+	}()
+	return p, nil
+}
+
+//execProcess a command started by docker exec
+type execProcess struct {
+	executor *Executor
+	container string
+	ID string
+	pid int
+	hijacked types.HijackedResponse
+	tty bool
+	stdout io.Reader
+	stderr io.Reader
+	copied chan struct{}
+	mu sync.Mutex
+	//signaled the last signal sent
+	signaled syscall.Signal
+}
+
+func (p *execProcess)Pid()int{
+	return p.pid
+}
+
+func (p *execProcess)Stdout()io.Reader{
+	return p.stdout
+}
+
+func (p *execProcess)Stderr()io.Reader{
+	return p.stderr
+}
+
+//Signal send a signal with kill in the container
+func (p *execProcess)Signal(sig os.Signal)error{
+	s, ok := sig.(syscall.Signal)
+	if !ok {
+		return fmt.Errorf("unsupported signal %s", sig.String())
+	}
+	p.setSignaled(s)
+	return p.kill("kill -" + strconv.Itoa(int(s)) + " " + strconv.Itoa(p.pid))
+}
+
+//killGroup kill the command and its children
+func (p *execProcess)killGroup()error{
+	p.setSignaled(syscall.SIGKILL)
+	return p.kill(shell.KillGroupScript(p.pid))
+}
+
+func (p *execProcess)setSignaled(sig syscall.Signal){
+	p.mu.Lock()
+	p.signaled = sig
+	p.mu.Unlock()
+}
+
+//kill run a kill command line in the container
+func (p *execProcess)kill(line string)error{
+	conn := p.executor.docker.conn
+	ctx := context.Background()
+	config := types.ExecConfig{
+		User: p.executor.User,
+		Cmd: []string{"/bin/sh", "-c", line},
+	}
+	created, err := conn.ContainerExecCreate(ctx, p.container, config)
+	if err != nil {
+		return err
+	}
+	return conn.ContainerExecStart(ctx, created.ID, types.ExecStartCheck{})
+}
+
+func (p *execProcess)Resize(size shell.WindowSize)error{
+	if !p.tty {
+		return fmt.Errorf("exec is not running in a tty")
+	}
+	options := types.ResizeOptions{Height: uint(size.Rows), Width: uint(size.Cols)}
+	return p.executor.docker.conn.ContainerExecResize(context.Background(), p.ID, options)
+}
+
+//Wait wait for the streams to end and get the exit code by inspecting the exec
+func (p *execProcess)Wait()(*shell.ExitStatus, error){
+	<-p.copied
+	p.hijacked.Close()
+	code, err := p.executor.docker.waitExec(p.ID)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return shell.ExitCodeStatus(code, p.signaled), nil
+}
+
+//pendingWriter buffer writes until it is released, the buffer is written by the next write or flush
+type pendingWriter struct {
+	mu sync.Mutex
+	w io.Writer
+	buf bytes.Buffer
+	released bool
+}
+
+func (w *pendingWriter)Write(p []byte)(int, error){
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.released {
+		return w.buf.Write(p)
+	}
+	if w.buf.Len() > 0 {
+		if _, err := w.buf.WriteTo(w.w); err != nil {
+			return 0, err
+		}
+	}
+	return w.w.Write(p)
+}
+
+func (w *pendingWriter)release(){
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.released = true
+}
+
+//flush write the buffer if it is released, or drop it
+func (w *pendingWriter)flush(){
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.released && w.buf.Len() > 0 {
+		w.buf.WriteTo(w.w)
+	}
+}
+
+func (w *pendingWriter)String()string{
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.String()
+}
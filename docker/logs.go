@@ -0,0 +1,153 @@
+///////////////////////////////////////////////////////////
+// logs.go
+// read and follow container logs
+// ycyxuehan kun1.huang@outlook.com
+//////////////////////////////////////////////////////////
+
+package docker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/ycyxuehan/binglibs/shell"
+)
+
+//LogLine a line of container logs
+type LogLine struct {
+	//Stream shell.STDOUT or shell.STDERR, shell.STDOUT for a tty container
+	Stream string
+	//Time the time the line was logged, zero if Timestamps is not set
+	Time time.Time
+	Text string
+}
+
+//LogsOptions which logs to read and where to deliver them
+type LogsOptions struct {
+	//Follow keep reading new logs until the container stops or the context is done
+	Follow bool
+	//Since logs after it, zero means from the beginning
+	Since time.Time
+	//Until logs before it, zero means up to now
+	Until time.Time
+	//Tail the number of lines from the end, all lines if <= 0
+	Tail int
+	//Timestamps parse the time of every line
+	Timestamps bool
+	//Stdout and Stderr the streams to read, both if neither is set
+	Stdout bool
+	Stderr bool
+	//OnLine called with every line
+	OnLine func(line LogLine)
+	//Lines receive every line, it is not closed by Logs
+	Lines chan<- LogLine
+}
+
+//deliver forward a log line
+func (o *LogsOptions)deliver(line LogLine){
+	if o.OnLine != nil {
+		o.OnLine(line)
+	}
+	if o.Lines != nil {
+		o.Lines <- line
+	}
+}
+
+//apiTime format a time for the since and until parameters
+func apiTime(t time.Time)string{
+	if t.IsZero() {
+		return ""
+	}
+	return fmt.Sprintf("%d.%09d", t.Unix(), t.Nanosecond())
+}
+
+//Logs read the logs of a container and deliver them line by line, it returns when the logs end
+func (d *Docker)Logs(ctx context.Context, ID string, opt LogsOptions)error{
+	if ID == "" {
+		return fmt.Errorf("container ID is empty")
+	}
+	if d.conn == nil {
+		return fmt.Errorf("can not connect to %s", d.ConnURI)
+	}
+	info, err := d.conn.ContainerInspect(ctx, ID)
+	if err != nil {
+		return fmt.Errorf("inspect container error: %s", err.Error())
+	}
+	options := types.ContainerLogsOptions{
+		ShowStdout: opt.Stdout || !opt.Stderr,
+		ShowStderr: opt.Stderr || !opt.Stdout,
+		Since: apiTime(opt.Since),
+		Until: apiTime(opt.Until),
+		Timestamps: opt.Timestamps,
+		Follow: opt.Follow,
+		Tail: "all",
+	}
+	if opt.Tail > 0 {
+		options.Tail = strconv.Itoa(opt.Tail)
+	}
+	reader, err := d.conn.ContainerLogs(ctx, ID, options)
+	if err != nil {
+		return fmt.Errorf("get container logs error: %s", err.Error())
+	}
+	defer reader.Close()
+	stdout := &logWriter{stream: shell.STDOUT, opt: &opt}
+	stderr := &logWriter{stream: shell.STDERR, opt: &opt}
+	if info.Config != nil && info.Config.Tty {
+		_, err = io.Copy(stdout, reader)
+	} else {
+		_, err = stdcopy.StdCopy(stdout, stderr, reader)
+	}
+	stdout.flush()
+	stderr.flush()
+	if err != nil && ctx.Err() == nil {
+		return fmt.Errorf("read container logs error: %s", err.Error())
+	}
+	return nil
+}
+
+//logWriter split a log stream into lines
+type logWriter struct {
+	stream string
+	opt *LogsOptions
+	buf bytes.Buffer
+}
+
+func (w *logWriter)Write(p []byte)(int, error){
+	w.buf.Write(p)
+	for {
+		i := bytes.IndexByte(w.buf.Bytes(), '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		line := string(w.buf.Next(i + 1))
+		w.send(strings.TrimRight(line, "\r\n"))
+	}
+}
+
+//flush send the last line without a newline
+func (w *logWriter)flush(){
+	if w.buf.Len() > 0 {
+		w.send(w.buf.String())
+		w.buf.Reset()
+	}
+}
+
+func (w *logWriter)send(text string){
+	line := LogLine{Stream: w.stream, Text: text}
+	if w.opt.Timestamps {
+		//a timestamp and a space are prepended by the daemon
+		if i := strings.IndexByte(text, ' '); i > 0 {
+			if t, err := time.Parse(time.RFC3339Nano, text[:i]); err == nil {
+				line.Time = t
+				line.Text = text[i+1:]
+			}
+		}
+	}
+	w.opt.deliver(line)
+}
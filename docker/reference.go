@@ -0,0 +1,132 @@
+///////////////////////////////////////////////////////////
+// reference.go
+// parse and normalise image references
+// ycyxuehan kun1.huang@outlook.com
+//////////////////////////////////////////////////////////
+
+package docker
+
+import (
+	"fmt"
+	"strings"
+	"github.com/docker/distribution/reference"
+)
+
+//DEFAULT_REGISTRY the registry of the images without a registry host
+const DEFAULT_REGISTRY = "docker.io"
+
+//DEFAULT_TAG the tag of a reference without tag and digest
+const DEFAULT_TAG = "latest"
+
+//Reference a normalised image reference, like docker.io/library/nginx:latest
+type Reference struct {
+	//Registry the registry host, docker.io if it is omitted
+	Registry string
+	//Repository the path in the registry, library/ is added for official images of docker.io
+	Repository string
+	//Tag DEFAULT_TAG if there is neither tag nor digest
+	Tag string
+	Digest string
+}
+
+//ParseReference parse an image reference with the normalisation rules of docker
+func ParseReference(image string)(*Reference, error){
+	if image == "" {
+		return nil, fmt.Errorf("image is empty")
+	}
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return nil, fmt.Errorf("invalid image %q: %s", image, err.Error())
+	}
+	ref := Reference{
+		Registry: reference.Domain(named),
+		Repository: reference.Path(named),
+	}
+	if tagged, ok := named.(reference.Tagged); ok {
+		ref.Tag = tagged.Tag()
+	}
+	if digested, ok := named.(reference.Digested); ok {
+		ref.Digest = digested.Digest().String()
+	}
+	if ref.Tag == "" && ref.Digest == "" {
+		ref.Tag = DEFAULT_TAG
+	}
+	return &ref, nil
+}
+
+//hasRegistry whether an image names its registry host, like docker.io/nginx or localhost:5000/app.
+//The first component is a host if it has a dot or a port or is localhost, the same rule as ParseReference.
+func hasRegistry(image string)bool{
+	i := strings.Index(image, "/")
+	if i <= 0 {
+		return false
+	}
+	host := image[:i]
+	return strings.ContainsAny(host, ".:") || host == "localhost"
+}
+
+//Name the registry and repository, like docker.io/library/nginx
+func (r *Reference)Name()string{
+	return r.Registry + "/" + r.Repository
+}
+
+//String the full reference, like docker.io/library/nginx:latest
+func (r *Reference)String()string{
+	s := r.Name()
+	if r.Tag != "" {
+		s += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		s += "@" + r.Digest
+	}
+	return s
+}
+
+//Familiar the short form shown by docker, like nginx:latest
+func (r *Reference)Familiar()string{
+	s := r.String()
+	if r.Registry == DEFAULT_REGISTRY {
+		s = strings.TrimPrefix(s, DEFAULT_REGISTRY+"/")
+		s = strings.TrimPrefix(s, "library/")
+	}
+	return s
+}
+
+//InRegistry the reference in another registry, a registry with a path like "harbor.local/project" prefixes the repository.
+//The library/ of the official images is dropped.
+func (r *Reference)InRegistry(registry string)*Reference{
+	moved := *r
+	parts := strings.SplitN(strings.TrimSuffix(registry, "/"), "/", 2)
+	moved.Registry = parts[0]
+	if r.Registry == DEFAULT_REGISTRY {
+		moved.Repository = strings.TrimPrefix(moved.Repository, "library/")
+	}
+	if len(parts) == 2 {
+		moved.Repository = parts[1] + "/" + moved.Repository
+	}
+	return &moved
+}
+
+//Equal whether two references point to the same image, digests are compared if both have one
+func (r *Reference)Equal(other *Reference)bool{
+	if r == nil || other == nil {
+		return r == other
+	}
+	if r.Name() != other.Name() {
+		return false
+	}
+	if r.Digest != "" && other.Digest != "" {
+		return r.Digest == other.Digest
+	}
+	return r.Tag == other.Tag && r.Digest == other.Digest
+}
+
+//SameImage whether two image strings are the same reference, the strings are compared if one is not a reference
+func SameImage(a string, b string)bool{
+	refA, errA := ParseReference(a)
+	refB, errB := ParseReference(b)
+	if errA != nil || errB != nil {
+		return a == b
+	}
+	return refA.Equal(refB)
+}
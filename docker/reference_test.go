@@ -0,0 +1,101 @@
+package docker
+
+import (
+	"testing"
+)
+
+func TestParseReference(t *testing.T){
+	tests := []struct {
+		image string
+		want Reference
+		familiar string
+	}{
+		{"nginx", Reference{"docker.io", "library/nginx", "latest", ""}, "nginx:latest"},
+		{"nginx:1.19", Reference{"docker.io", "library/nginx", "1.19", ""}, "nginx:1.19"},
+		{"docker.io/library/nginx", Reference{"docker.io", "library/nginx", "latest", ""}, "nginx:latest"},
+		{"index.docker.io/team/app:v1", Reference{"docker.io", "team/app", "v1", ""}, "team/app:v1"},
+		{"team/app", Reference{"docker.io", "team/app", "latest", ""}, "team/app:latest"},
+		{"localhost/app", Reference{"localhost", "app", "latest", ""}, "localhost/app:latest"},
+		{"reg.local:5000/a/b/c:2", Reference{"reg.local:5000", "a/b/c", "2", ""}, "reg.local:5000/a/b/c:2"},
+		{
+			"quay.io/app@sha256:" + testDigest,
+			Reference{"quay.io", "app", "", "sha256:" + testDigest},
+			"quay.io/app@sha256:" + testDigest,
+		},
+		{
+			"app:v2@sha256:" + testDigest,
+			Reference{"docker.io", "library/app", "v2", "sha256:" + testDigest},
+			"app:v2@sha256:" + testDigest,
+		},
+	}
+	for _, test := range tests {
+		ref, err := ParseReference(test.image)
+		if err != nil {
+			t.Errorf("%s: %s", test.image, err)
+			continue
+		}
+		if *ref != test.want {
+			t.Errorf("%s: %+v, want %+v", test.image, *ref, test.want)
+		}
+		if ref.Familiar() != test.familiar {
+			t.Errorf("%s: familiar %s, want %s", test.image, ref.Familiar(), test.familiar)
+		}
+		again, err := ParseReference(ref.String())
+		if err != nil || !again.Equal(ref) {
+			t.Errorf("%s: %s does not parse to the same reference", test.image, ref.String())
+		}
+	}
+	for _, image := range []string{"", "UPPER/case", "app:", "a b"} {
+		if _, err := ParseReference(image); err == nil {
+			t.Errorf("%q: invalid image accepted", image)
+		}
+	}
+}
+
+const testDigest = "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae"
+
+func TestSameImage(t *testing.T){
+	tests := []struct {
+		a string
+		b string
+		same bool
+	}{
+		{"nginx", "docker.io/library/nginx:latest", true},
+		{"nginx", "nginx:1.19", false},
+		{"team/app", "index.docker.io/team/app", true},
+		{"reg.local/app", "app", false},
+		{"app@sha256:" + testDigest, "app:v1@sha256:" + testDigest, true},
+		{"sha256:" + testDigest, "sha256:" + testDigest, true},
+	}
+	for _, test := range tests {
+		if SameImage(test.a, test.b) != test.same {
+			t.Errorf("SameImage(%s, %s) != %t", test.a, test.b, test.same)
+		}
+	}
+}
+
+func TestImageRegistry(t *testing.T){
+	tests := []struct {
+		registry string
+		image string
+		want string
+	}{
+		{"", "nginx", "nginx"},
+		{"reg.local:5000", "nginx", "reg.local:5000/nginx:latest"},
+		{"reg.local/proj/", "team/app:1", "reg.local/proj/team/app:1"},
+		{"harbor.local/proj", "library/nginx", "harbor.local/proj/nginx:latest"},
+		{"reg.local", "other.io/app", "other.io/app"},
+		{"reg.local", "localhost/app", "localhost/app"},
+		{"reg.local", "localhost:5000/app", "localhost:5000/app"},
+		{"reg.local", "docker.io/library/nginx", "docker.io/library/nginx"},
+		{"harbor.local/proj", "index.docker.io/library/nginx", "index.docker.io/library/nginx"},
+		{"reg.local", "app@sha256:" + testDigest, "reg.local/app@sha256:" + testDigest},
+		{"reg.local", "Invalid", "Invalid"},
+	}
+	for _, test := range tests {
+		opt := CreateContainerOptions{Registry: test.registry, Image: test.image}
+		if got := opt.image(); got != test.want {
+			t.Errorf("%s in %s: %s, want %s", test.image, test.registry, got, test.want)
+		}
+	}
+}
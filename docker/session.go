@@ -0,0 +1,51 @@
+///////////////////////////////////////////////////////////
+// session.go
+// buildkit session exposing secrets and ssh agents to a build
+// ycyxuehan kun1.huang@outlook.com
+//////////////////////////////////////////////////////////
+
+package docker
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"github.com/moby/buildkit/session"
+	"github.com/moby/buildkit/session/secrets/secretsprovider"
+	"github.com/moby/buildkit/session/sshforward/sshprovider"
+)
+
+//startSession start a buildkit session for the secrets and ssh agents of a build, it runs until ctx is done
+func (d *Docker)startSession(ctx context.Context, opt *BuildImageOptions)(*session.Session, error){
+	s, err := session.NewSession(ctx, "binglibs", opt.Context)
+	if err != nil {
+		return nil, fmt.Errorf("new build session error: %s", err.Error())
+	}
+	if len(opt.Secrets) > 0 {
+		sources := []secretsprovider.FileSource{}
+		for id, file := range opt.Secrets {
+			sources = append(sources, secretsprovider.FileSource{ID: id, FilePath: file})
+		}
+		store, err := secretsprovider.NewFileStore(sources)
+		if err != nil {
+			return nil, fmt.Errorf("load build secrets error: %s", err.Error())
+		}
+		s.Allow(secretsprovider.NewSecretProvider(store))
+	}
+	if len(opt.SSH) > 0 {
+		configs := []sshprovider.AgentConfig{}
+		for id, paths := range opt.SSH {
+			configs = append(configs, sshprovider.AgentConfig{ID: id, Paths: paths})
+		}
+		provider, err := sshprovider.NewSSHAgentProvider(configs)
+		if err != nil {
+			return nil, fmt.Errorf("load build ssh agents error: %s", err.Error())
+		}
+		s.Allow(provider)
+	}
+	dialer := func(ctx context.Context, proto string, meta map[string][]string)(net.Conn, error){
+		return d.conn.DialHijack(ctx, "/session", proto, meta)
+	}
+	go s.Run(ctx, dialer)
+	return s, nil
+}
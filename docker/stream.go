@@ -0,0 +1,116 @@
+///////////////////////////////////////////////////////////
+// stream.go
+// decode the json message stream of the docker daemon
+// ycyxuehan kun1.huang@outlook.com
+//////////////////////////////////////////////////////////
+
+package docker
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"github.com/docker/docker/pkg/jsonmessage"
+)
+
+//decodeStream decode json messages from r and call fn with each of them until EOF or fn returns an error
+func decodeStream(r io.Reader, fn func(msg *jsonmessage.JSONMessage)error)error{
+	decoder := json.NewDecoder(r)
+	for {
+		var msg jsonmessage.JSONMessage
+		err := decoder.Decode(&msg)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("decode message error: %s", err.Error())
+		}
+		err = fn(&msg)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+//messageError the error of a message, nil if it is not an error
+func messageError(msg *jsonmessage.JSONMessage)*jsonmessage.JSONError{
+	if msg.Error != nil {
+		return msg.Error
+	}
+	if msg.ErrorMessage != "" {
+		return &jsonmessage.JSONError{Message: msg.ErrorMessage}
+	}
+	return nil
+}
+
+//Progress a progress event of an image pull or push
+type Progress struct {
+	//ID the layer id, empty for a message of the whole image
+	ID string
+	Status string
+	//Current bytes done, zero if it is unknown
+	Current int64
+	//Total bytes of the layer, zero if it is unknown
+	Total int64
+}
+
+//Percent the percentage done, -1 if it is unknown
+func (p Progress)Percent()int{
+	if p.Total <= 0 {
+		return -1
+	}
+	return int(p.Current * 100 / p.Total)
+}
+
+//String implement Stringer
+func (p Progress)String()string{
+	s := p.Status
+	if p.ID != "" {
+		s = p.ID + ": " + s
+	}
+	if p.Total > 0 {
+		s = fmt.Sprintf("%s %d/%d", s, p.Current, p.Total)
+	}
+	return s
+}
+
+//ProgressFunc receive the progress events of a pull or push
+type ProgressFunc func(p Progress)
+
+//ProgressError an error reported by the daemon in the stream of a pull or push
+type ProgressError struct {
+	//Action pull or push
+	Action string
+	Image string
+	Code int
+	Message string
+}
+
+//Error implement error
+func (e *ProgressError)Error()string{
+	return fmt.Sprintf("%s image %s error: %s", e.Action, e.Image, e.Message)
+}
+
+//decodeProgress decode the stream of a pull or push, the statuses are returned as lines
+func decodeProgress(r io.Reader, action string, image string, fn ProgressFunc)([]string, error){
+	lines := []string{}
+	err := decodeStream(r, func(msg *jsonmessage.JSONMessage)error{
+		if jsonErr := messageError(msg); jsonErr != nil {
+			return &ProgressError{Action: action, Image: image, Code: jsonErr.Code, Message: jsonErr.Message}
+		}
+		p := Progress{ID: msg.ID, Status: msg.Status}
+		if msg.Progress != nil {
+			p.Current = msg.Progress.Current
+			p.Total = msg.Progress.Total
+		}
+		//progress bars are only sent to fn
+		if msg.Progress == nil {
+			lines = append(lines, p.String())
+		}
+		if fn != nil {
+			fn(p)
+		}
+		return nil
+	})
+	return lines, err
+}
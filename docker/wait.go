@@ -0,0 +1,265 @@
+///////////////////////////////////////////////////////////
+// wait.go
+// wait for containers to reach a condition
+// ycyxuehan kun1.huang@outlook.com
+//////////////////////////////////////////////////////////
+
+package docker
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/go-connections/nat"
+)
+
+//WAIT_INTERVAL how often the container is inspected while waiting
+const WAIT_INTERVAL = 500 * time.Millisecond
+
+//Condition a condition a container is waited for
+type Condition struct {
+	//Name describe the condition, like "healthy"
+	Name string
+	//check whether the condition is reached, an error means it can not be reached any more
+	check func(ctx context.Context, d *Docker, info *types.ContainerJSON)(bool, error)
+}
+
+//stopped an error if the container is not running and will not be restarted
+func stopped(info *types.ContainerJSON)error{
+	state := info.State
+	if state == nil || state.Running || state.Restarting || state.Status == "created" {
+		return nil
+	}
+	return fmt.Errorf("container is %s with exit code %d", state.Status, state.ExitCode)
+}
+
+//Running the container is running
+func Running()Condition{
+	return Condition{
+		Name: "running",
+		check: func(ctx context.Context, d *Docker, info *types.ContainerJSON)(bool, error){
+			if info.State.Running && !info.State.Restarting {
+				return true, nil
+			}
+			return false, stopped(info)
+		},
+	}
+}
+
+//Healthy the HEALTHCHECK of the container passes
+func Healthy()Condition{
+	return Condition{
+		Name: "healthy",
+		check: func(ctx context.Context, d *Docker, info *types.ContainerJSON)(bool, error){
+			if info.State.Health == nil && info.Config != nil {
+				check := info.Config.Healthcheck
+				if check == nil || len(check.Test) == 0 || check.Test[0] == "NONE" {
+					return false, fmt.Errorf("container has no healthcheck")
+				}
+			}
+			if info.State.Health != nil && info.State.Health.Status == types.Healthy {
+				return true, nil
+			}
+			return false, stopped(info)
+		},
+	}
+}
+
+//Exited the container exited with code, any code if it is < 0
+func Exited(code int)Condition{
+	name := "exited"
+	if code >= 0 {
+		name = fmt.Sprintf("exited with code %d", code)
+	}
+	return Condition{
+		Name: name,
+		check: func(ctx context.Context, d *Docker, info *types.ContainerJSON)(bool, error){
+			state := info.State
+			if state.Running || state.Restarting || state.Status == "created" {
+				return false, nil
+			}
+			if code >= 0 && state.ExitCode != code {
+				return false, fmt.Errorf("container exited with code %d", state.ExitCode)
+			}
+			return true, nil
+		},
+	}
+}
+
+//PortOpen a tcp port of the container accepts connections.
+//The published host port is dialed if there is one, or the port at the container address.
+func PortOpen(port int)Condition{
+	return Condition{
+		Name: fmt.Sprintf("accepting tcp on port %d", port),
+		check: func(ctx context.Context, d *Docker, info *types.ContainerJSON)(bool, error){
+			if !info.State.Running {
+				return false, stopped(info)
+			}
+			addr := containerAddr(info, port)
+			if addr == "" {
+				return false, nil
+			}
+			conn, err := net.DialTimeout("tcp", addr, WAIT_INTERVAL)
+			if err != nil {
+				return false, nil
+			}
+			conn.Close()
+			return true, nil
+		},
+	}
+}
+
+//containerAddr the address a port of a container is reached at, empty if it has none yet
+func containerAddr(info *types.ContainerJSON, port int)string{
+	settings := info.NetworkSettings
+	if settings == nil {
+		return ""
+	}
+	for _, binding := range settings.Ports[nat.Port(strconv.Itoa(port)+"/tcp")] {
+		host := binding.HostIP
+		if host == "" || host == "0.0.0.0" || host == "::" {
+			host = "127.0.0.1"
+		}
+		return net.JoinHostPort(host, binding.HostPort)
+	}
+	ip := settings.IPAddress
+	for _, network := range settings.Networks {
+		if ip == "" && network != nil {
+			ip = network.IPAddress
+		}
+	}
+	if ip == "" {
+		return ""
+	}
+	return net.JoinHostPort(ip, strconv.Itoa(port))
+}
+
+//LogMatches a line of the container logs matches the regexp expr, the logs are followed from the beginning.
+//The condition is used by one WaitFor only.
+func LogMatches(expr string)Condition{
+	re, err := regexp.Compile(expr)
+	var once sync.Once
+	matched := make(chan struct{})
+	return Condition{
+		Name: fmt.Sprintf("logging %q", expr),
+		check: func(ctx context.Context, d *Docker, info *types.ContainerJSON)(bool, error){
+			if err != nil {
+				return false, fmt.Errorf("invalid regexp %q: %s", expr, err.Error())
+			}
+			once.Do(func(){
+				go func(){
+					var closeOnce sync.Once
+					opt := LogsOptions{Follow: true, OnLine: func(line LogLine){
+						if re.MatchString(line.Text) {
+							closeOnce.Do(func(){ close(matched) })
+						}
+					}}
+					d.Logs(ctx, info.ID, opt)
+				}()
+			})
+			select {
+			case <-matched:
+				return true, nil
+			default:
+			}
+			return false, stopped(info)
+		},
+	}
+}
+
+//WaitError a container did not reach a condition
+type WaitError struct {
+	ID string
+	Condition string
+	//State the last observed state of the container
+	State string
+	Err error
+}
+
+//Error implement error
+func (e *WaitError)Error()string{
+	return fmt.Sprintf("wait for container %s to be %s error: %s (last state: %s)", e.ID, e.Condition, e.Err.Error(), e.State)
+}
+
+//describeState describe the state of a container for a wait error
+func describeState(info *types.ContainerJSON)string{
+	if info == nil || info.State == nil {
+		return "unknown"
+	}
+	state := info.State
+	parts := []string{state.Status}
+	if !state.Running && state.Status != "created" {
+		parts = append(parts, fmt.Sprintf("exit code %d", state.ExitCode))
+	}
+	if state.OOMKilled {
+		parts = append(parts, "oom killed")
+	}
+	if state.Error != "" {
+		parts = append(parts, state.Error)
+	}
+	if health := state.Health; health != nil {
+		s := "health " + health.Status
+		if health.FailingStreak > 0 {
+			s += fmt.Sprintf(", failing streak %d", health.FailingStreak)
+		}
+		if n := len(health.Log); n > 0 && health.Log[n-1].ExitCode != 0 {
+			s += ": " + strings.TrimSpace(health.Log[n-1].Output)
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, ", ")
+}
+
+//WaitFor wait until a container reaches all the conditions or ctx is done
+func (d *Docker)WaitFor(ctx context.Context, ID string, conditions ...Condition)error{
+	if ID == "" {
+		return fmt.Errorf("container ID is empty")
+	}
+	if d.conn == nil {
+		return fmt.Errorf("can not connect to %s", d.ConnURI)
+	}
+	if len(conditions) == 0 {
+		conditions = []Condition{Running()}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	names := []string{}
+	for _, condition := range conditions {
+		names = append(names, condition.Name)
+	}
+	condition := strings.Join(names, " and ")
+	var last *types.ContainerJSON
+	ticker := time.NewTicker(WAIT_INTERVAL)
+	defer ticker.Stop()
+	for {
+		info, err := d.conn.ContainerInspect(ctx, ID)
+		if err != nil && ctx.Err() == nil {
+			return &WaitError{ID: ID, Condition: condition, State: describeState(last), Err: err}
+		}
+		if err == nil {
+			last = &info
+			reached := true
+			for _, c := range conditions {
+				ok, err := c.check(ctx, d, &info)
+				if err != nil {
+					return &WaitError{ID: ID, Condition: condition, State: describeState(last), Err: err}
+				}
+				reached = reached && ok
+			}
+			if reached {
+				return nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return &WaitError{ID: ID, Condition: condition, State: describeState(last), Err: ctx.Err()}
+		case <-ticker.C:
+		}
+	}
+}
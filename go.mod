@@ -1,7 +1,52 @@
 module github.com/ycyxuehan/binglibs
 
+go 1.26.0
+
+require (
+	//image reference normalisation, see docker/reference.go
+	github.com/docker/distribution v2.7.1+incompatible
+	github.com/docker/docker v1.4.2-0.20200309214505-aa6a9891b09c
+	github.com/docker/go-connections v0.3.0
+	//buildkit sessions of builds with secrets and ssh, see docker/session.go
+	github.com/moby/buildkit v0.7.2
+	golang.org/x/crypto v0.57.0
+	gopkg.in/src-d/go-git.v4 v4.13.1
+)
+
 require (
-    gopkg.in/src-d/go-git.v4
-    github.com/docker/docker
-    
-)
\ No newline at end of file
+	github.com/Azure/go-ansiterm v0.0.0-20250102033503-faa5f7b0171c // indirect
+	github.com/Microsoft/go-winio v0.4.15-0.20190919025122-fc70bd9a86b5 // indirect
+	github.com/containerd/containerd v1.4.0-0 // indirect
+	github.com/docker/go-units v0.4.0 // indirect
+	github.com/emirpasic/gods v1.12.0 // indirect
+	github.com/gogo/protobuf v1.3.1 // indirect
+	github.com/golang/protobuf v1.3.3 // indirect
+	github.com/google/go-cmp v0.6.0 // indirect
+	github.com/grpc-ecosystem/grpc-opentracing v0.0.0-20180507213350-8e809c8a8645 // indirect
+	github.com/jbenet/go-context v0.0.0-20150711004518-d14ea06fba99 // indirect
+	github.com/kevinburke/ssh_config v0.0.0-20190725054713-01f96b0aa0cd // indirect
+	github.com/konsorten/go-windows-terminal-sequences v1.0.2 // indirect
+	github.com/mitchellh/go-homedir v1.1.0 // indirect
+	github.com/morikuni/aec v0.0.0-20170113033406-39771216ff4c // indirect
+	github.com/opencontainers/go-digest v1.0.0-rc1 // indirect
+	github.com/opencontainers/image-spec v1.0.1 // indirect
+	github.com/opentracing/opentracing-go v0.0.0-20171003133519-1361b9cd60be // indirect
+	github.com/pkg/errors v0.9.1 // indirect
+	github.com/sergi/go-diff v1.0.0 // indirect
+	github.com/sirupsen/logrus v1.4.2 // indirect
+	github.com/src-d/gcfg v1.4.0 // indirect
+	github.com/xanzy/ssh-agent v0.2.1 // indirect
+	golang.org/x/net v0.58.0 // indirect
+	golang.org/x/sync v0.23.0 // indirect
+	golang.org/x/sys v0.48.0 // indirect
+	golang.org/x/text v0.42.0 // indirect
+	google.golang.org/genproto v0.0.0-20200227132054-3f1135a288c9 // indirect
+	google.golang.org/grpc v1.27.1 // indirect
+	gopkg.in/src-d/go-billy.v4 v4.3.2 // indirect
+	gopkg.in/warnings.v0 v0.1.2 // indirect
+)
+
+//buildkit v0.7.2 builds against these containerd and docker versions
+replace github.com/containerd/containerd => github.com/containerd/containerd v1.3.3
+
+replace github.com/docker/docker => github.com/docker/docker v1.4.2-0.20200309214505-aa6a9891b09c
@@ -0,0 +1,192 @@
+///////////////////////////////////////////////////////////
+// broker.go
+// fan-out command output to subscribers
+// ycyxuehan kun1.huang@outlook.com
+//////////////////////////////////////////////////////////
+
+package shell
+
+import (
+	"sync"
+	"time"
+)
+
+//streams
+const (
+	STDOUT = "stdout"
+	STDERR = "stderr"
+)
+
+//DEFAULT_BUFFER_SIZE messages kept by a broker for replay
+const DEFAULT_BUFFER_SIZE = 1024
+
+//Message a line of command output
+type Message struct {
+	Seq uint64 `json:"seq"`
+	Time time.Time `json:"time"`
+	Stream string `json:"stream"`
+	Text string `json:"text"`
+}
+
+//Broker fan out messages to subscribers.
+//The latest messages are kept in a ring buffer and replayed to late subscribers.
+//A subscriber never misses a message published after it subscribed:
+//Publish blocks while the slowest subscriber is a full buffer behind.
+type Broker struct {
+	mu sync.Mutex
+	cond *sync.Cond
+	buf []Message
+	next uint64
+	subs map[*Subscription]struct{}
+	closed bool
+}
+
+//Subscription a subscriber of a broker
+type Subscription struct {
+	C <-chan Message
+	broker *Broker
+	cursor uint64
+	cancelled bool
+	done chan struct{}
+}
+
+//NewBroker new a broker keeping size messages, size <= 0 means DEFAULT_BUFFER_SIZE
+func NewBroker(size int)*Broker{
+	if size <= 0 {
+		size = DEFAULT_BUFFER_SIZE
+	}
+	b := &Broker{
+		buf: make([]Message, size),
+		next: 1,
+		subs: make(map[*Subscription]struct{}),
+	}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+//Publish publish a line, the message with sequence and time is returned
+func (b *Broker)Publish(stream string, text string)Message{
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for !b.closed && b.full() {
+		b.cond.Wait()
+	}
+	msg := Message{
+		Seq: b.next,
+		Time: time.Now(),
+		Stream: stream,
+		Text: text,
+	}
+	if b.closed {
+		return msg
+	}
+	b.buf[b.next%uint64(len(b.buf))] = msg
+	b.next++
+	b.cond.Broadcast()
+	return msg
+}
+
+//full a subscriber has not read the oldest message yet
+func (b *Broker)full()bool{
+	for sub := range b.subs {
+		if b.next-sub.cursor >= uint64(len(b.buf)) {
+			return true
+		}
+	}
+	return false
+}
+
+//oldest sequence of the oldest message kept
+func (b *Broker)oldest()uint64{
+	size := uint64(len(b.buf))
+	if b.next > size {
+		return b.next - size
+	}
+	return 1
+}
+
+//Messages the messages kept in the buffer
+func (b *Broker)Messages()[]Message{
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	msgs := []Message{}
+	for seq := b.oldest(); seq < b.next; seq++ {
+		msgs = append(msgs, b.buf[seq%uint64(len(b.buf))])
+	}
+	return msgs
+}
+
+//Subscribe subscribe the broker, the kept messages are delivered first if replay is true.
+//The channel is closed after the broker is closed and all messages are delivered.
+func (b *Broker)Subscribe(replay bool)*Subscription{
+	ch := make(chan Message)
+	sub := &Subscription{
+		C: ch,
+		broker: b,
+		done: make(chan struct{}),
+	}
+	b.mu.Lock()
+	sub.cursor = b.next
+	if replay {
+		sub.cursor = b.oldest()
+	}
+	b.subs[sub] = struct{}{}
+	b.mu.Unlock()
+	go sub.run(ch)
+	return sub
+}
+
+//Close close the broker, subscribers receive the remaining messages and then their channel is closed
+func (b *Broker)Close(){
+	b.mu.Lock()
+	b.closed = true
+	b.cond.Broadcast()
+	b.mu.Unlock()
+}
+
+//Closed whether the broker is closed
+func (b *Broker)Closed()bool{
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.closed
+}
+
+func (sub *Subscription)run(ch chan<- Message){
+	defer close(ch)
+	b := sub.broker
+	for {
+		b.mu.Lock()
+		for !sub.cancelled && !b.closed && sub.cursor >= b.next {
+			b.cond.Wait()
+		}
+		if sub.cancelled || sub.cursor >= b.next {
+			delete(b.subs, sub)
+			b.cond.Broadcast()
+			b.mu.Unlock()
+			return
+		}
+		msg := b.buf[sub.cursor%uint64(len(b.buf))]
+		b.mu.Unlock()
+		select {
+		case ch <- msg:
+		case <-sub.done:
+		}
+		b.mu.Lock()
+		sub.cursor++
+		b.cond.Broadcast()
+		b.mu.Unlock()
+	}
+}
+
+//Unsubscribe stop receiving messages, the channel is closed
+func (sub *Subscription)Unsubscribe(){
+	b := sub.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if sub.cancelled {
+		return
+	}
+	sub.cancelled = true
+	close(sub.done)
+	b.cond.Broadcast()
+}
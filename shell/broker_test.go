@@ -0,0 +1,89 @@
+package shell
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestBrokerConcurrent(t *testing.T){
+	const publishers, lines = 4, 200
+	b := NewBroker(8)
+	subs := []*Subscription{}
+	for i := 0; i < 4; i++ {
+		subs = append(subs, b.Subscribe(false))
+	}
+	var wg sync.WaitGroup
+	counts := make([]int, len(subs))
+	for i, sub := range subs {
+		wg.Add(1)
+		go func(i int, sub *Subscription){
+			defer wg.Done()
+			var last uint64
+			for msg := range sub.C {
+				if msg.Seq <= last {
+					t.Errorf("subscriber %d: seq %d after %d", i, msg.Seq, last)
+				}
+				last = msg.Seq
+				counts[i]++
+			}
+		}(i, sub)
+	}
+	//a subscriber leaving early must not block the publishers
+	quitter := b.Subscribe(true)
+	wg.Add(1)
+	go func(){
+		defer wg.Done()
+		<-quitter.C
+		quitter.Unsubscribe()
+		for range quitter.C {
+		}
+	}()
+	var pub sync.WaitGroup
+	for p := 0; p < publishers; p++ {
+		pub.Add(1)
+		go func(p int){
+			defer pub.Done()
+			for i := 0; i < lines; i++ {
+				b.Publish(STDOUT, fmt.Sprintf("%d-%d", p, i))
+				b.Messages()
+			}
+		}(p)
+	}
+	pub.Wait()
+	b.Close()
+	wg.Wait()
+	for i, n := range counts {
+		if n != publishers*lines {
+			t.Errorf("subscriber %d received %d messages, want %d", i, n, publishers*lines)
+		}
+	}
+	if msg := b.Publish(STDOUT, "closed"); msg.Seq != publishers*lines+1 {
+		t.Errorf("publish after close: seq %d", msg.Seq)
+	}
+	if n := len(b.Messages()); n != 8 {
+		t.Errorf("kept %d messages, want 8", n)
+	}
+}
+
+func TestShellSubscribeNextRun(t *testing.T){
+	s := NewWithShell(SH)
+	if err := s.Exec("echo first"); err != nil {
+		t.Fatal(err)
+	}
+	sub := s.Subscribe(false)
+	if err := s.Exec("echo second"); err != nil {
+		t.Fatal(err)
+	}
+	texts := []string{}
+	for msg := range sub.C {
+		texts = append(texts, msg.Text)
+	}
+	if len(texts) != 1 || texts[0] != "second" {
+		t.Errorf("subscriber received %q, want [second]", texts)
+	}
+	msgs := s.Output().Messages()
+	if len(msgs) != 1 || msgs[0].Text != "second" {
+		t.Errorf("output of the last command %v", msgs)
+	}
+}
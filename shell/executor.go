@@ -0,0 +1,108 @@
+///////////////////////////////////////////////////////////
+// executor.go
+// where a command is executed
+// ycyxuehan kun1.huang@outlook.com
+//////////////////////////////////////////////////////////
+
+package shell
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"syscall"
+)
+
+//Command a command to execute
+type Command struct {
+	//Path the interpreter
+	Path string
+	//Args the args after Path, with the script as the last one
+	Args []string
+	Dir string
+	Env []string
+	EnvMode EnvMode
+	Stdin io.Reader
+	PTY bool
+	WindowSize WindowSize
+	Limits *Limits
+}
+
+//ExitStatus how a command exited
+type ExitStatus struct {
+	//Code exit code, -1 if it is killed by a signal
+	Code int
+	//Message like "exit status 1" or "signal: killed"
+	Message string
+	Limits LimitResult
+}
+
+//Success whether the command succeeded
+func (e *ExitStatus)Success()bool{
+	return e.Code == 0
+}
+
+//ExitCodeStatus the status of a command run by a shell on another host, 128+n is the code of a command killed by signal n.
+//signaled is the last signal sent to the command, the code is reported as killed by it like a local command.
+func ExitCodeStatus(code int, signaled syscall.Signal)*ExitStatus{
+	if signaled != 0 && code == 128+int(signaled) {
+		return &ExitStatus{Code: -1, Message: "signal: " + signaled.String()}
+	}
+	return &ExitStatus{Code: code, Message: fmt.Sprintf("exit status %d", code)}
+}
+
+//groupScript print the pid of "$@" and run it in its own process group, so it is killed with its children.
+//setsid does not fork in the background job, which is not a group leader. The stdin of a background job is /dev/null,
+//so it is passed as fd 3. Without setsid the command replaces the shell.
+const groupScript = `if command -v setsid >/dev/null 2>&1; then
+exec 3<&0
+setsid "$@" <&3 3<&- &
+pid=$!
+exec 3<&-
+echo "$pid"
+wait "$pid"
+exit $?
+fi
+echo "$$"
+exec "$@"`
+
+//pidScript print the pid and run "$@", a command with a pty is a session leader and leads its own process group
+const pidScript = `echo "$$" && exec "$@"`
+
+//GroupArgv the argv running path with args on a remote host or in a container with /bin/sh.
+//The pid printed first is also the process group to kill, see KillGroupScript.
+func GroupArgv(path string, args []string, pty bool)[]string{
+	script := groupScript
+	if pty {
+		script = pidScript
+	}
+	return append([]string{SH, "-c", script, "sh", path}, args...)
+}
+
+//KillGroupScript the shell command killing the process group of pid started by GroupArgv, or pid only if it leads no group
+func KillGroupScript(pid int)string{
+	p := strconv.Itoa(pid)
+	return "kill -9 -" + p + " 2>/dev/null || kill -9 " + p
+}
+
+//Process a started command
+type Process interface {
+	Pid() int
+	//Stdout the output, stdout and stderr are merged in PTY mode
+	Stdout() io.Reader
+	//Stderr nil in PTY mode
+	Stderr() io.Reader
+	Signal(sig os.Signal) error
+	//Resize change the terminal size in PTY mode
+	Resize(size WindowSize) error
+	//Wait wait for the command after its output is read.
+	//An error is returned only if the exit status cannot be got.
+	Wait() (*ExitStatus, error)
+}
+
+//Executor start commands, the command is killed when ctx is done
+type Executor interface {
+	Start(ctx context.Context, cmd *Command) (Process, error)
+}
@@ -0,0 +1,203 @@
+///////////////////////////////////////////////////////////
+// fanout.go
+// run a command on many targets in parallel
+// ycyxuehan kun1.huang@outlook.com
+//////////////////////////////////////////////////////////
+
+package shell
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+//Target where a command of a fan out runs
+type Target struct {
+	Name string
+	//Executor a local, container or ssh executor, nil means LocalExecutor
+	Executor Executor
+	Dir string
+	Env []string
+}
+
+//TargetResult the result of a target, Status is STEP_SUCCEEDED, STEP_FAILED or STEP_SKIPPED
+type TargetResult struct {
+	Name string `json:"name"`
+	Status string `json:"status"`
+	ExitCode int `json:"exitCode"`
+	Error string `json:"error,omitempty"`
+	Start time.Time `json:"start"`
+	Duration Duration `json:"duration"`
+	//Output the kept output of the target
+	Output []Message `json:"output,omitempty"`
+}
+
+//FanOutReport the results of a fan out in target order
+type FanOutReport struct {
+	Results []TargetResult `json:"results"`
+	Start time.Time `json:"start"`
+	Duration Duration `json:"duration"`
+}
+
+//names the targets with a status
+func (r *FanOutReport)names(status string)[]string{
+	names := []string{}
+	for _, result := range r.Results {
+		if result.Status == status {
+			names = append(names, result.Name)
+		}
+	}
+	return names
+}
+
+//Succeeded the targets succeeded
+func (r *FanOutReport)Succeeded()[]string{
+	return r.names(STEP_SUCCEEDED)
+}
+
+//Failed the targets failed
+func (r *FanOutReport)Failed()[]string{
+	return r.names(STEP_FAILED)
+}
+
+//Skipped the targets not run because of fail fast or cancel
+func (r *FanOutReport)Skipped()[]string{
+	return r.names(STEP_SKIPPED)
+}
+
+//OK whether every target succeeded
+func (r *FanOutReport)OK()bool{
+	return len(r.Succeeded()) == len(r.Results)
+}
+
+//FanOut run a command on targets with a concurrency cap.
+//The output of every target is merged into Output with a "[name] " prefix.
+type FanOut struct {
+	//Concurrency targets run at the same time, <= 0 means all
+	Concurrency int
+	//FailFast cancel the other targets when one fails, otherwise every target is run
+	FailFast bool
+	//Shell interpreter, BASH if empty
+	Shell string
+	//Redactor mask secrets in the output and errors
+	Redactor *Redactor
+	mu sync.Mutex
+	output *Broker
+}
+
+//NewFanOut new a fan out
+func NewFanOut(concurrency int, failFast bool)*FanOut{
+	return &FanOut{
+		Concurrency: concurrency,
+		FailFast: failFast,
+		output: NewBroker(DEFAULT_BUFFER_SIZE),
+	}
+}
+
+//Output the merged output of the current or last run
+func (f *FanOut)Output()*Broker{
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.output == nil {
+		f.output = NewBroker(DEFAULT_BUFFER_SIZE)
+	}
+	return f.output
+}
+
+//Subscribe subscribe the merged output of the current or next run
+func (f *FanOut)Subscribe(replay bool)*Subscription{
+	return f.Output().Subscribe(replay)
+}
+
+//Run run a command on every target and wait for them
+func (f *FanOut)Run(ctx context.Context, targets []Target, args ...string)*FanOutReport{
+	f.mu.Lock()
+	if f.output == nil || f.output.Closed() {
+		f.output = NewBroker(DEFAULT_BUFFER_SIZE)
+	}
+	output := f.output
+	f.mu.Unlock()
+	defer output.Close()
+
+	report := &FanOutReport{
+		Results: make([]TargetResult, len(targets)),
+		Start: time.Now(),
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	concurrency := f.Concurrency
+	if concurrency <= 0 || concurrency > len(targets) {
+		concurrency = len(targets)
+	}
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i := range targets {
+		report.Results[i] = TargetResult{
+			Name: targets[i].Name,
+			Status: STEP_SKIPPED,
+			ExitCode: -1,
+		}
+	}
+	//start the targets in order
+	for i := range targets {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			for j := i; j < len(targets); j++ {
+				report.Results[j].Error = ctx.Err().Error()
+			}
+			break
+		}
+		wg.Add(1)
+		go func(i int){
+			defer wg.Done()
+			defer func(){ <-slots }()
+			f.runTarget(ctx, &targets[i], output, &report.Results[i], args)
+			if report.Results[i].Status == STEP_FAILED && f.FailFast {
+				cancel()
+			}
+		}(i)
+	}
+	wg.Wait()
+	report.Duration = Duration(time.Since(report.Start))
+	return report
+}
+
+//runTarget run the command on a target and forward its output
+func (f *FanOut)runTarget(ctx context.Context, target *Target, output *Broker, result *TargetResult, args []string){
+	interpreter := f.Shell
+	if interpreter == "" {
+		interpreter = BASH
+	}
+	s := NewWithShell(interpreter)
+	s.Executor = target.Executor
+	s.Dir = target.Dir
+	s.Env = target.Env
+	s.Redactor = f.Redactor
+	prefix := "[" + target.Name + "] "
+	sub := s.Subscribe(false)
+	forwarded := make(chan struct{})
+	go func(){
+		for msg := range sub.C {
+			output.Publish(msg.Stream, prefix+msg.Text)
+		}
+		close(forwarded)
+	}()
+	result.Start = time.Now()
+	err := s.ExecContext(ctx, args...)
+	<-forwarded
+	result.Duration = Duration(time.Since(result.Start))
+	result.ExitCode = s.ExitCode()
+	result.Output = s.Output().Messages()
+	if err != nil {
+		result.Status = STEP_FAILED
+		result.Error = strings.TrimSpace(err.Error())
+		output.Publish(STDERR, prefix+result.Error)
+		return
+	}
+	result.Status = STEP_SUCCEEDED
+}
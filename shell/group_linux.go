@@ -0,0 +1,27 @@
+// +build linux
+
+///////////////////////////////////////////////////////////
+// group_linux.go
+// run local commands in their own process group
+// ycyxuehan kun1.huang@outlook.com
+//////////////////////////////////////////////////////////
+
+package shell
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+//processGroup run the command in a new process group
+func processGroup(command *exec.Cmd){
+	if command.SysProcAttr == nil {
+		command.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	command.SysProcAttr.Setpgid = true
+}
+
+//killGroup kill the process group of a started command
+func killGroup(command *exec.Cmd)error{
+	return syscall.Kill(-command.Process.Pid, syscall.SIGKILL)
+}
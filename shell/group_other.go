@@ -0,0 +1,19 @@
+// +build !linux
+
+///////////////////////////////////////////////////////////
+// group_other.go
+// process groups are not supported, only the command is killed
+// ycyxuehan kun1.huang@outlook.com
+//////////////////////////////////////////////////////////
+
+package shell
+
+import (
+	"os/exec"
+)
+
+func processGroup(command *exec.Cmd){}
+
+func killGroup(command *exec.Cmd)error{
+	return command.Process.Kill()
+}
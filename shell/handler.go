@@ -0,0 +1,182 @@
+///////////////////////////////////////////////////////////
+// handler.go
+// parse and match output lines
+// ycyxuehan kun1.huang@outlook.com
+//////////////////////////////////////////////////////////
+
+package shell
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+//LineHandler handle the output lines of a shell.
+//It is called with one line at a time in the order of the output, stdout and stderr are read by different goroutines.
+//It must not block or call SendMsg, the output is not read meanwhile.
+type LineHandler interface {
+	Handle(msg Message)
+}
+
+//LineHandlerFunc a func as a LineHandler
+type LineHandlerFunc func(msg Message)
+
+//Handle implement LineHandler
+func (f LineHandlerFunc)Handle(msg Message){
+	f(msg)
+}
+
+//AddHandler handle every line of the following commands
+func (s *Shell)AddHandler(handlers ...LineHandler){
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers = append(s.handlers, handlers...)
+}
+
+//handle call the handlers with a line
+func (s *Shell)handle(msg Message){
+	s.mu.Lock()
+	handlers := s.handlers
+	s.mu.Unlock()
+	for _, handler := range handlers {
+		handler.Handle(msg)
+	}
+}
+
+//Matcher capture the submatches of the lines matching a regexp
+type Matcher struct {
+	re *regexp.Regexp
+	mu sync.Mutex
+	matches [][]string
+	//Stream only match lines of STDOUT or STDERR, empty means both
+	Stream string
+	//OnMatch called with every matched line and its submatches
+	OnMatch func(msg Message, match []string)
+}
+
+//NewMatcher new a matcher of a regexp
+func NewMatcher(expr string)(*Matcher, error){
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	return &Matcher{re: re}, nil
+}
+
+//Handle implement LineHandler
+func (m *Matcher)Handle(msg Message){
+	if m.Stream != "" && m.Stream != msg.Stream {
+		return
+	}
+	match := m.re.FindStringSubmatch(msg.Text)
+	if match == nil {
+		return
+	}
+	m.mu.Lock()
+	m.matches = append(m.matches, match)
+	m.mu.Unlock()
+	if m.OnMatch != nil {
+		m.OnMatch(msg, match)
+	}
+}
+
+//Matched whether a line matched
+func (m *Matcher)Matched()bool{
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.matches) > 0
+}
+
+//All the submatches of every matched line
+func (m *Matcher)All()[][]string{
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([][]string{}, m.matches...)
+}
+
+//Last the submatches of the last matched line, nil if no line matched
+func (m *Matcher)Last()[]string{
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.matches) == 0 {
+		return nil
+	}
+	return m.matches[len(m.matches)-1]
+}
+
+//Value the named group of the last matched line
+func (m *Matcher)Value(name string)string{
+	last := m.Last()
+	i := m.re.SubexpIndex(name)
+	if last == nil || i < 0 {
+		return ""
+	}
+	return last[i]
+}
+
+//JSONLines decode the lines that are json objects
+type JSONLines struct {
+	//OnObject called with every decoded object
+	OnObject func(msg Message, object map[string]interface{})
+	//OnError called with lines looking like json that cannot be decoded, or every other line if Strict
+	OnError func(msg Message, err error)
+	//Strict lines not starting with { are errors
+	Strict bool
+}
+
+//Handle implement LineHandler
+func (j *JSONLines)Handle(msg Message){
+	text := strings.TrimSpace(msg.Text)
+	if !strings.HasPrefix(text, "{") {
+		if j.Strict && j.OnError != nil {
+			j.OnError(msg, fmt.Errorf("line is not a json object"))
+		}
+		return
+	}
+	var object map[string]interface{}
+	err := json.Unmarshal([]byte(text), &object)
+	if err != nil {
+		if j.OnError != nil {
+			j.OnError(msg, err)
+		}
+		return
+	}
+	if j.OnObject != nil {
+		j.OnObject(msg, object)
+	}
+}
+
+//Expect wait for a line matching re, the kept lines are checked first.
+//The matched line and its submatches are returned, an error if the broker is closed without a match or ctx is done.
+func (b *Broker)Expect(ctx context.Context, re *regexp.Regexp)(Message, []string, error){
+	sub := b.Subscribe(true)
+	defer sub.Unsubscribe()
+	for {
+		select {
+		case msg, ok := <-sub.C:
+			if !ok {
+				return Message{}, nil, fmt.Errorf("no line matches %s", re.String())
+			}
+			if match := re.FindStringSubmatch(msg.Text); match != nil {
+				return msg, match, nil
+			}
+		case <-ctx.Done():
+			return Message{}, nil, fmt.Errorf("wait for a line matching %s error: %s", re.String(), ctx.Err().Error())
+		}
+	}
+}
+
+//Expect wait for a line of the current or next command matching expr, the command keeps running.
+//The submatches are returned.
+func (s *Shell)Expect(ctx context.Context, expr string)([]string, error){
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	_, match, err := s.nextOutput().Expect(ctx, re)
+	return match, err
+}
@@ -0,0 +1,109 @@
+///////////////////////////////////////////////////////////
+// limits.go
+// resource limits of a command
+// ycyxuehan kun1.huang@outlook.com
+//////////////////////////////////////////////////////////
+
+package shell
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+//Limits resource limits of a command, zero means no limit.
+//CPUTime, OpenFiles and CoreSize are rlimits set with ulimit by /bin/sh before the interpreter is started.
+//Memory, CPUs and Pids need cgroup v2 on linux.
+type Limits struct {
+	//CPUTime cpu time in seconds, the command gets SIGXCPU when it is exceeded and SIGKILL a second later
+	CPUTime time.Duration `json:"cpuTime,omitempty" yaml:"cpuTime,omitempty"`
+	//OpenFiles max open files
+	OpenFiles uint64 `json:"openFiles,omitempty" yaml:"openFiles,omitempty"`
+	//CoreSize max core file size in bytes, DisableCore to disable core files
+	CoreSize uint64 `json:"coreSize,omitempty" yaml:"coreSize,omitempty"`
+	DisableCore bool `json:"disableCore,omitempty" yaml:"disableCore,omitempty"`
+	//Memory max memory in bytes, swap is disabled
+	Memory int64 `json:"memory,omitempty" yaml:"memory,omitempty"`
+	//CPUs cpu quota in cores, 0.5 means half a core
+	CPUs float64 `json:"cpus,omitempty" yaml:"cpus,omitempty"`
+	//Pids max processes and threads
+	Pids int64 `json:"pids,omitempty" yaml:"pids,omitempty"`
+	//CgroupParent the cgroup v2 directory the command cgroup is created in, it is required by Memory, CPUs and Pids.
+	//It must be writable and have no processes (the no internal process rule of cgroup v2),
+	//and the memory, cpu and pids controllers must be available to it.
+	CgroupParent string `json:"cgroupParent,omitempty" yaml:"cgroupParent,omitempty"`
+	//DelegateCgroup use the cgroup of the current process if CgroupParent is empty.
+	//The whole process is moved into its child LEAF_CGROUP and the controllers of its cgroup are enabled for the children,
+	//it can not be undone. Do not set it if the cgroup is managed by another program, like a systemd unit.
+	DelegateCgroup bool `json:"delegateCgroup,omitempty" yaml:"delegateCgroup,omitempty"`
+}
+
+//LimitResult which limits were hit by the last command
+type LimitResult struct {
+	OOMKilled bool `json:"oomKilled"`
+	CPUTimeExceeded bool `json:"cpuTimeExceeded"`
+	PidsLimited bool `json:"pidsLimited"`
+	CPUThrottled bool `json:"cpuThrottled"`
+}
+
+//Hit whether a limit that fails the command was hit
+func (r LimitResult)Hit()bool{
+	return r.OOMKilled || r.CPUTimeExceeded || r.PidsLimited
+}
+
+//String implement fmt.Stringer
+func (r LimitResult)String()string{
+	hits := []string{}
+	if r.OOMKilled {
+		hits = append(hits, "oom killed")
+	}
+	if r.CPUTimeExceeded {
+		hits = append(hits, "cpu time exceeded")
+	}
+	if r.PidsLimited {
+		hits = append(hits, "pids limit reached")
+	}
+	if r.CPUThrottled {
+		hits = append(hits, "cpu throttled")
+	}
+	return strings.Join(hits, ", ")
+}
+
+//hasRlimits whether an rlimit is set
+func (l *Limits)hasRlimits()bool{
+	return l.CPUTime > 0 || l.OpenFiles > 0 || l.CoreSize > 0 || l.DisableCore
+}
+
+//HasCgroup whether a cgroup limit is set
+func (l *Limits)HasCgroup()bool{
+	return l.Memory > 0 || l.CPUs > 0 || l.Pids > 0
+}
+
+//ulimit the ulimit commands of /bin/sh, the sizes are in 512-byte blocks
+func (l *Limits)ulimit()string{
+	cmds := []string{}
+	if l.CPUTime > 0 {
+		//the hard limit is a second later, so the command gets SIGXCPU before SIGKILL
+		seconds := int64((l.CPUTime + time.Second - 1) / time.Second)
+		cmds = append(cmds, "ulimit -S -t "+strconv.FormatInt(seconds, 10), "ulimit -H -t "+strconv.FormatInt(seconds+1, 10))
+	}
+	if l.OpenFiles > 0 {
+		cmds = append(cmds, "ulimit -n "+strconv.FormatUint(l.OpenFiles, 10))
+	}
+	if l.DisableCore {
+		cmds = append(cmds, "ulimit -c 0")
+	} else if l.CoreSize > 0 {
+		cmds = append(cmds, "ulimit -c "+strconv.FormatUint((l.CoreSize+511)/512, 10))
+	}
+	return strings.Join(cmds, " && ")
+}
+
+//Wrap wrap the interpreter and its args with /bin/sh setting the rlimits
+func (l *Limits)Wrap(name string, args []string)(string, []string){
+	if !l.hasRlimits() {
+		return name, args
+	}
+	script := l.ulimit() + ` && exec "$@"`
+	return SH, append([]string{"-c", script, "sh", name}, args...)
+}
@@ -0,0 +1,207 @@
+// +build linux
+
+///////////////////////////////////////////////////////////
+// limits_linux.go
+// cgroup v2 limits on linux
+// ycyxuehan kun1.huang@outlook.com
+//////////////////////////////////////////////////////////
+
+package shell
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+//CGROUP_ROOT the cgroup v2 mount point
+const CGROUP_ROOT = "/sys/fs/cgroup"
+
+//LEAF_CGROUP the child cgroup the current process is moved into when its own cgroup is the parent
+const LEAF_CGROUP = "binglibs-leaf"
+
+var cgroupSeq uint64
+
+var leafMu sync.Mutex
+
+//cgroup a cgroup created for a command
+type cgroup struct {
+	path string
+	dir *os.File
+}
+
+//currentCgroup the cgroup v2 directory of the current process
+func currentCgroup()(string, error){
+	data, err := ioutil.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, "0::") {
+			return filepath.Join(CGROUP_ROOT, strings.TrimPrefix(line, "0::")), nil
+		}
+	}
+	return "", fmt.Errorf("cgroup v2 is not available")
+}
+
+//ownCgroup the cgroup of the current process made usable as a parent, for Limits.DelegateCgroup.
+//A cgroup with processes can not enable controllers for its children, so the process is moved into LEAF_CGROUP.
+func ownCgroup()(string, error){
+	leafMu.Lock()
+	defer leafMu.Unlock()
+	current, err := currentCgroup()
+	if err != nil {
+		return "", err
+	}
+	if filepath.Base(current) == LEAF_CGROUP {
+		return filepath.Dir(current), nil
+	}
+	leaf := filepath.Join(current, LEAF_CGROUP)
+	err = os.Mkdir(leaf, 0755)
+	if err != nil && !os.IsExist(err) {
+		return "", fmt.Errorf("create cgroup %s error: %s", leaf, err.Error())
+	}
+	err = ioutil.WriteFile(filepath.Join(leaf, "cgroup.procs"), []byte(strconv.Itoa(os.Getpid())), 0644)
+	if err != nil {
+		return "", fmt.Errorf("move the current process into %s error: %s", leaf, err.Error())
+	}
+	return current, nil
+}
+
+//newCgroup create a cgroup with the limits
+func newCgroup(l *Limits)(*cgroup, error){
+	if _, err := os.Stat(filepath.Join(CGROUP_ROOT, "cgroup.controllers")); err != nil {
+		return nil, fmt.Errorf("cgroup v2 is not available")
+	}
+	parent := l.CgroupParent
+	if parent == "" && !l.DelegateCgroup {
+		return nil, fmt.Errorf("cgroup parent is required by memory, cpu and pids limits")
+	}
+	if parent == "" {
+		var err error
+		parent, err = ownCgroup()
+		if err != nil {
+			return nil, err
+		}
+	}
+	controllers := []string{}
+	if l.Memory > 0 {
+		controllers = append(controllers, "+memory")
+	}
+	if l.CPUs > 0 {
+		controllers = append(controllers, "+cpu")
+	}
+	if l.Pids > 0 {
+		controllers = append(controllers, "+pids")
+	}
+	err := ioutil.WriteFile(filepath.Join(parent, "cgroup.subtree_control"), []byte(strings.Join(controllers, " ")), 0644)
+	if errors.Is(err, syscall.EBUSY) {
+		return nil, fmt.Errorf("enable cgroup controllers in %s error: %s, the cgroup has processes", parent, err.Error())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("enable cgroup controllers in %s error: %s", parent, err.Error())
+	}
+	path := filepath.Join(parent, fmt.Sprintf("binglibs-%d-%d", os.Getpid(), atomic.AddUint64(&cgroupSeq, 1)))
+	err = os.Mkdir(path, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("create cgroup error: %s", err.Error())
+	}
+	c := &cgroup{path: path}
+	settings := map[string]string{}
+	if l.Memory > 0 {
+		settings["memory.max"] = strconv.FormatInt(l.Memory, 10)
+		settings["memory.swap.max"] = "0"
+	}
+	if l.CPUs > 0 {
+		settings["cpu.max"] = fmt.Sprintf("%d 100000", int64(l.CPUs*100000))
+	}
+	if l.Pids > 0 {
+		settings["pids.max"] = strconv.FormatInt(l.Pids, 10)
+	}
+	for name, value := range settings {
+		err = ioutil.WriteFile(filepath.Join(path, name), []byte(value), 0644)
+		if err != nil && !(name == "memory.swap.max" && os.IsNotExist(err)) {
+			c.remove()
+			return nil, fmt.Errorf("set %s error: %s", name, err.Error())
+		}
+	}
+	c.dir, err = os.Open(path)
+	if err != nil {
+		c.remove()
+		return nil, err
+	}
+	return c, nil
+}
+
+//apply start the command in the cgroup
+func (c *cgroup)apply(command *exec.Cmd){
+	if command.SysProcAttr == nil {
+		command.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	command.SysProcAttr.UseCgroupFD = true
+	command.SysProcAttr.CgroupFD = int(c.dir.Fd())
+}
+
+//events read a flat keyed file of the cgroup
+func (c *cgroup)events(name string)map[string]int64{
+	events := map[string]int64{}
+	f, err := os.Open(filepath.Join(c.path, name))
+	if err != nil {
+		return events
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		n, err := strconv.ParseInt(fields[1], 10, 64)
+		if err == nil {
+			events[fields[0]] = n
+		}
+	}
+	return events
+}
+
+//result which limits were hit
+func (c *cgroup)result(r *LimitResult){
+	r.OOMKilled = c.events("memory.events")["oom_kill"] > 0
+	r.PidsLimited = c.events("pids.events")["max"] > 0
+	r.CPUThrottled = c.events("cpu.stat")["nr_throttled"] > 0
+}
+
+//remove kill the remaining processes and remove the cgroup
+func (c *cgroup)remove(){
+	if c.dir != nil {
+		c.dir.Close()
+	}
+	ioutil.WriteFile(filepath.Join(c.path, "cgroup.kill"), []byte("1"), 0644)
+	os.Remove(c.path)
+}
+
+//cpuTimeExceeded whether the command was killed by SIGXCPU, or by SIGKILL after it used the cpu time
+func cpuTimeExceeded(state *os.ProcessState, limit time.Duration)bool{
+	if state == nil {
+		return false
+	}
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		switch status.Signal() {
+		case syscall.SIGXCPU:
+			return true
+		case syscall.SIGKILL:
+			return state.UserTime()+state.SystemTime() >= limit
+		}
+	}
+	return state.ExitCode() == 128+int(syscall.SIGXCPU)
+}
@@ -0,0 +1,36 @@
+// +build !linux
+
+///////////////////////////////////////////////////////////
+// limits_other.go
+// cgroup limits are not supported
+// ycyxuehan kun1.huang@outlook.com
+//////////////////////////////////////////////////////////
+
+package shell
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"time"
+)
+
+//xcpuExitCode exit code of a shell whose child is killed by SIGXCPU
+const xcpuExitCode = 128 + 24
+
+type cgroup struct{}
+
+func newCgroup(l *Limits)(*cgroup, error){
+	return nil, fmt.Errorf("cgroup limits are not supported on %s", runtime.GOOS)
+}
+
+func (c *cgroup)apply(command *exec.Cmd){}
+
+func (c *cgroup)result(r *LimitResult){}
+
+func (c *cgroup)remove(){}
+
+func cpuTimeExceeded(state *os.ProcessState, limit time.Duration)bool{
+	return state != nil && state.ExitCode() == xcpuExitCode
+}
@@ -0,0 +1,210 @@
+///////////////////////////////////////////////////////////
+// local.go
+// execute commands on the local host
+// ycyxuehan kun1.huang@outlook.com
+//////////////////////////////////////////////////////////
+
+package shell
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+//LocalExecutor run commands on the local host, it is the default executor
+type LocalExecutor struct{}
+
+//Start implement Executor
+func (LocalExecutor)Start(ctx context.Context, c *Command)(Process, error){
+	name, args := c.Path, c.Args
+	if c.Limits != nil {
+		name, args = c.Limits.Wrap(name, args)
+	}
+	command := exec.CommandContext(ctx, name, args...)
+	command.Dir = c.Dir
+	command.Env = environ(c.EnvMode, c.Env)
+	command.Stdin = c.Stdin
+	p := &localProcess{command: command, limits: c.Limits}
+	//the children are killed with the command when ctx is done,
+	//the output is closed WAIT_DELAY later if a process outside the group keeps it open
+	processGroup(command)
+	command.Cancel = func()error{
+		time.AfterFunc(WAIT_DELAY, p.closeOutput)
+		return killGroup(command)
+	}
+	var err error
+	if c.Limits != nil && c.Limits.HasCgroup() {
+		p.group, err = newCgroup(c.Limits)
+		if err != nil {
+			return nil, err
+		}
+		p.group.apply(command)
+	}
+	if c.PTY {
+		p.ptmx, err = startPty(command, c.WindowSize)
+		if err == nil {
+			p.stdout = ptyReader{p.ptmx}
+			if c.Stdin != nil {
+				go io.Copy(p.ptmx, c.Stdin)
+			}
+		}
+	} else {
+		//not StdoutPipe: its pipes can not be closed by the Cancel hook while they are read
+		err = p.startPipes()
+	}
+	if err != nil {
+		if p.group != nil {
+			p.group.remove()
+		}
+		return nil, err
+	}
+	return p, nil
+}
+
+//environ the environment of a local command, nil means inherit
+func environ(mode EnvMode, override []string)[]string{
+	switch mode {
+	case ENV_INHERIT:
+		return nil
+	case ENV_REPLACE:
+		if override == nil {
+			return []string{}
+		}
+		return override
+	}
+	if len(override) == 0 {
+		return nil
+	}
+	env := []string{}
+	index := map[string]int{}
+	for _, e := range append(os.Environ(), override...) {
+		key := strings.SplitN(e, "=", 2)[0]
+		if i, ok := index[key]; ok {
+			env[i] = e
+			continue
+		}
+		index[key] = len(env)
+		env = append(env, e)
+	}
+	return env
+}
+
+//WAIT_DELAY how long the output is still read after a command is killed by its context
+const WAIT_DELAY = time.Second
+
+type localProcess struct {
+	command *exec.Cmd
+	stdout io.Reader
+	stderr io.Reader
+	//files the read ends of the output pipes
+	files []*os.File
+	ptmx *os.File
+	group *cgroup
+	limits *Limits
+	closeOnce sync.Once
+}
+
+//startPipes start the command with its stdout and stderr connected to pipes
+func (p *localProcess)startPipes()error{
+	stdout, stdoutWriter, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	stderr, stderrWriter, err := os.Pipe()
+	if err != nil {
+		stdout.Close()
+		stdoutWriter.Close()
+		return err
+	}
+	p.files = []*os.File{stdout, stderr}
+	p.stdout, p.stderr = pipeReader{stdout}, pipeReader{stderr}
+	p.command.Stdout = stdoutWriter
+	p.command.Stderr = stderrWriter
+	err = p.command.Start()
+	//the command has its own copies, the output ends when every process holding them exits
+	stdoutWriter.Close()
+	stderrWriter.Close()
+	if err != nil {
+		p.closeOutput()
+	}
+	return err
+}
+
+//closeOutput close the output, the readers get EOF
+func (p *localProcess)closeOutput(){
+	p.closeOnce.Do(func(){
+		for _, f := range p.files {
+			f.Close()
+		}
+		if p.ptmx != nil {
+			p.ptmx.Close()
+		}
+	})
+}
+
+//pipeReader read a pipe, a pipe closed by closeOutput means EOF
+type pipeReader struct {
+	file *os.File
+}
+
+func (r pipeReader)Read(b []byte)(int, error){
+	n, err := r.file.Read(b)
+	if errors.Is(err, os.ErrClosed) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (p *localProcess)Pid()int{
+	return p.command.Process.Pid
+}
+
+func (p *localProcess)Stdout()io.Reader{
+	return p.stdout
+}
+
+func (p *localProcess)Stderr()io.Reader{
+	return p.stderr
+}
+
+func (p *localProcess)Signal(sig os.Signal)error{
+	return p.command.Process.Signal(sig)
+}
+
+func (p *localProcess)Resize(size WindowSize)error{
+	if p.ptmx == nil {
+		return fmt.Errorf("shell is not running in a pty")
+	}
+	return setWindowSize(p.ptmx, size)
+}
+
+func (p *localProcess)Wait()(*ExitStatus, error){
+	err := p.command.Wait()
+	p.closeOutput()
+	state := p.command.ProcessState
+	if state == nil {
+		return nil, err
+	}
+	status := &ExitStatus{
+		Code: state.ExitCode(),
+		Message: state.String(),
+	}
+	if p.limits != nil && p.limits.CPUTime > 0 {
+		status.Limits.CPUTimeExceeded = cpuTimeExceeded(state, p.limits.CPUTime)
+	}
+	if p.group != nil {
+		p.group.result(&status.Limits)
+		p.group.remove()
+	}
+	if _, ok := err.(*exec.ExitError); ok {
+		err = nil
+	}
+	return status, err
+}
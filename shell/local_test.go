@@ -0,0 +1,78 @@
+package shell
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimeoutKillsChildren(t *testing.T){
+	for _, pty := range []bool{false, true} {
+		s := NewWithShell(SH)
+		s.PTY = pty
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		begin := time.Now()
+		err := s.ExecContext(ctx, "echo a; sleep 4; echo b")
+		cancel()
+		if err == nil {
+			t.Errorf("pty %t: no error after the timeout", pty)
+		}
+		if elapsed := time.Since(begin); elapsed > 2*time.Second {
+			t.Errorf("pty %t: killed after %s", pty, elapsed)
+		}
+		for _, msg := range s.Output().Messages() {
+			if msg.Text == "b" {
+				t.Errorf("pty %t: output after the timeout", pty)
+			}
+		}
+	}
+}
+
+//a command leaving a background child succeeds once the child closes the output
+func TestBackgroundChild(t *testing.T){
+	s := NewWithShell(SH)
+	if err := s.Exec("(sleep 1; echo late) & echo early"); err != nil || s.ExitCode() != 0 {
+		t.Fatalf("error %v, exit code %d", err, s.ExitCode())
+	}
+	texts := []string{}
+	for _, msg := range s.Output().Messages() {
+		texts = append(texts, msg.Text)
+	}
+	if strings.Join(texts, ",") != "early,late" {
+		t.Errorf("output %q", texts)
+	}
+}
+
+func TestTimeoutChildOutsideGroup(t *testing.T){
+	if _, err := exec.LookPath("setsid"); err != nil {
+		t.Skip("setsid not found")
+	}
+	s := NewWithShell(SH)
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	begin := time.Now()
+	err := s.ExecContext(ctx, "setsid sleep 5 & sleep 5")
+	if err == nil {
+		t.Error("no error after the timeout")
+	}
+	if elapsed := time.Since(begin); elapsed > 300*time.Millisecond+WAIT_DELAY+time.Second {
+		t.Errorf("killed after %s", elapsed)
+	}
+}
+
+func TestOutputAndExitCode(t *testing.T){
+	s := NewWithShell(SH)
+	err := s.Exec("echo out; echo err >&2; exit 3")
+	if err == nil || s.ExitCode() != 3 {
+		t.Fatalf("error %v, exit code %d", err, s.ExitCode())
+	}
+	streams := map[string]string{}
+	for _, msg := range s.Output().Messages() {
+		streams[msg.Stream] += msg.Text
+	}
+	if streams[STDOUT] != "out" || streams[STDERR] != "err" {
+		t.Errorf("output %v", streams)
+	}
+}
@@ -0,0 +1,387 @@
+///////////////////////////////////////////////////////////
+// logstore.go
+// persist command output as json lines with rotation
+// ycyxuehan kun1.huang@outlook.com
+//////////////////////////////////////////////////////////
+
+package shell
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//DEFAULT_LOG_SIZE size of a log file before it is rotated
+const DEFAULT_LOG_SIZE = 10 << 20
+
+//LOG_EXT extension of a log file
+const LOG_EXT = ".log"
+
+//LogStore store the output of jobs in Dir, a log file per job
+type LogStore struct {
+	Dir string
+	//MaxSize rotate a log file when it exceeds MaxSize bytes, zero means no rotation
+	MaxSize int64
+	//MaxAge rotate a log file when its first message is older than MaxAge, zero means no rotation by age
+	MaxAge time.Duration
+	//Retention remove rotated files older than Retention, zero means keep them
+	Retention time.Duration
+	//Compress gzip rotated files
+	Compress bool
+}
+
+//NewLogStore new a log store in dir, rotated at DEFAULT_LOG_SIZE with compression
+func NewLogStore(dir string)(*LogStore, error){
+	if dir == "" {
+		return nil, fmt.Errorf("log dir is empty")
+	}
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	return &LogStore{
+		Dir: dir,
+		MaxSize: DEFAULT_LOG_SIZE,
+		Compress: true,
+	}, nil
+}
+
+//path the current log file of a job
+func (l *LogStore)path(job string)(string, error){
+	if job == "" || strings.ContainsAny(job, `/\`) || job == "." || job == ".." {
+		return "", fmt.Errorf("invalid job name %q", job)
+	}
+	return filepath.Join(l.Dir, job+LOG_EXT), nil
+}
+
+//rotated the rotated files of a job, oldest first
+func (l *LogStore)rotated(job string)([]string, error){
+	path, err := l.path(job)
+	if err != nil {
+		return nil, err
+	}
+	files, err := filepath.Glob(path + ".*")
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+//Jobs list the jobs having a log
+func (l *LogStore)Jobs()([]string, error){
+	infos, err := ioutil.ReadDir(l.Dir)
+	if err != nil {
+		return nil, err
+	}
+	jobs := []string{}
+	seen := map[string]bool{}
+	for _, info := range infos {
+		name := info.Name()
+		i := strings.Index(name, LOG_EXT)
+		if info.IsDir() || i <= 0 {
+			continue
+		}
+		job := name[:i]
+		if !seen[job] {
+			seen[job] = true
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs, nil
+}
+
+//Writer open the log of a job for appending
+func (l *LogStore)Writer(job string)(*LogWriter, error){
+	path, err := l.path(job)
+	if err != nil {
+		return nil, err
+	}
+	w := &LogWriter{store: l, job: job, path: path}
+	err = w.open()
+	if err != nil {
+		return nil, err
+	}
+	l.clean(job)
+	return w, nil
+}
+
+//Record write the messages of a broker to the log of a job until the broker is closed.
+//The kept messages are written first, the returned channel receives the result when it is done.
+func (l *LogStore)Record(job string, b *Broker)(<-chan error, error){
+	w, err := l.Writer(job)
+	if err != nil {
+		return nil, err
+	}
+	sub := b.Subscribe(true)
+	result := make(chan error, 1)
+	go func(){
+		var err error
+		for msg := range sub.C {
+			if err == nil {
+				err = w.Write(msg)
+			}
+		}
+		closeErr := w.Close()
+		if err == nil {
+			err = closeErr
+		}
+		result <- err
+	}()
+	return result, nil
+}
+
+//Read read the log of a job from the oldest rotated file, skipping offset messages and returning at most limit messages.
+//limit <= 0 means all.
+func (l *LogStore)Read(job string, offset int, limit int)([]Message, error){
+	path, err := l.path(job)
+	if err != nil {
+		return nil, err
+	}
+	files, err := l.rotated(job)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(path); err == nil {
+		files = append(files, path)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("log of job %s not found", job)
+	}
+	msgs := []Message{}
+	for _, file := range files {
+		done, err := readLog(file, &offset, limit, &msgs)
+		if err != nil {
+			return msgs, err
+		}
+		if done {
+			break
+		}
+	}
+	return msgs, nil
+}
+
+//readLog read messages from a log file, true is returned when limit is reached
+func readLog(file string, offset *int, limit int, msgs *[]Message)(bool, error){
+	f, err := os.Open(file)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if strings.HasSuffix(file, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return false, fmt.Errorf("read %s error: %s", file, err.Error())
+		}
+		defer gz.Close()
+		r = gz
+	}
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 && line[len(line)-1] == '\n' {
+			if *offset > 0 {
+				*offset--
+			} else {
+				var msg Message
+				if jsonErr := json.Unmarshal(line, &msg); jsonErr != nil {
+					return false, fmt.Errorf("read %s error: %s", file, jsonErr.Error())
+				}
+				*msgs = append(*msgs, msg)
+				if limit > 0 && len(*msgs) >= limit {
+					return true, nil
+				}
+			}
+		}
+		if err == io.EOF {
+			//a partial last line is being written
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+}
+
+//rotate move the current log of a job aside and compress it
+func (l *LogStore)rotate(job string, path string)error{
+	rotated := fmt.Sprintf("%s.%020d", path, time.Now().UnixNano())
+	err := os.Rename(path, rotated)
+	if err != nil {
+		return err
+	}
+	if l.Compress {
+		err = compressFile(rotated)
+		if err != nil {
+			return err
+		}
+	}
+	l.clean(job)
+	return nil
+}
+
+//clean remove the rotated files older than Retention
+func (l *LogStore)clean(job string){
+	if l.Retention <= 0 {
+		return
+	}
+	files, err := l.rotated(job)
+	if err != nil {
+		return
+	}
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err == nil && time.Since(info.ModTime()) > l.Retention {
+			os.Remove(file)
+		}
+	}
+}
+
+//compressFile gzip a file to file.gz and remove it
+func compressFile(file string)error{
+	src, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.Create(file + ".gz")
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(dst)
+	_, err = io.Copy(gz, src)
+	if err == nil {
+		err = gz.Close()
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file + ".gz")
+		return err
+	}
+	src.Close()
+	return os.Remove(file)
+}
+
+//LogWriter append messages to the log of a job
+type LogWriter struct {
+	mu sync.Mutex
+	store *LogStore
+	job string
+	path string
+	file *os.File
+	size int64
+	//since the time of the first message in the file
+	since time.Time
+}
+
+func (w *LogWriter)open()error{
+	file, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	w.file = file
+	w.size = info.Size()
+	w.since = time.Time{}
+	if w.size > 0 {
+		w.since = firstTime(w.path, info.ModTime())
+	}
+	return nil
+}
+
+//firstTime the time of the first message of a log file, def if it can not be read
+func firstTime(path string, def time.Time)time.Time{
+	f, err := os.Open(path)
+	if err != nil {
+		return def
+	}
+	defer f.Close()
+	line, err := bufio.NewReader(f).ReadBytes('\n')
+	if err != nil {
+		return def
+	}
+	var msg Message
+	if json.Unmarshal(line, &msg) != nil || msg.Time.IsZero() {
+		return def
+	}
+	return msg.Time
+}
+
+//expired whether the file must be rotated before data is written, w.mu must be held
+func (w *LogWriter)expired(data []byte)bool{
+	if w.size == 0 {
+		return false
+	}
+	store := w.store
+	if store.MaxSize > 0 && w.size+int64(len(data)) > store.MaxSize {
+		return true
+	}
+	return store.MaxAge > 0 && time.Since(w.since) > store.MaxAge
+}
+
+//Write write a message as a json line, the file is rotated if it exceeds MaxSize or MaxAge
+func (w *LogWriter)Write(msg Message)error{
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return fmt.Errorf("log of job %s is closed", w.job)
+	}
+	if w.expired(data) {
+		err = w.file.Close()
+		w.file = nil
+		if err != nil {
+			return err
+		}
+		err = w.store.rotate(w.job, w.path)
+		if err != nil {
+			return err
+		}
+		err = w.open()
+		if err != nil {
+			return err
+		}
+	}
+	if w.size == 0 {
+		w.since = msg.Time
+		if w.since.IsZero() {
+			w.since = time.Now()
+		}
+	}
+	n, err := w.file.Write(data)
+	w.size += int64(n)
+	return err
+}
+
+//Close close the log file
+func (w *LogWriter)Close()error{
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
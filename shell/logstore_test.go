@@ -0,0 +1,96 @@
+package shell
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogStoreRotation(t *testing.T){
+	now := time.Now()
+	tests := []struct {
+		name string
+		maxSize int64
+		maxAge time.Duration
+		times []time.Time
+		rotated int
+	}{
+		{"no rotation", 0, 0, []time.Time{now, now, now}, 0},
+		{"size", 150, 0, []time.Time{now, now, now, now}, 3},
+		{"age", 0, time.Hour, []time.Time{now.Add(-2 * time.Hour), now, now}, 1},
+		{"young", 0, time.Hour, []time.Time{now.Add(-time.Minute), now, now}, 0},
+	}
+	for _, test := range tests {
+		for _, compress := range []bool{false, true} {
+			name := fmt.Sprintf("%s compress %t", test.name, compress)
+			store, err := NewLogStore(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			store.MaxSize = test.maxSize
+			store.MaxAge = test.maxAge
+			store.Compress = compress
+			w, err := store.Writer("job")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, tm := range test.times {
+				err = w.Write(Message{Seq: uint64(i + 1), Time: tm, Stream: STDOUT, Text: fmt.Sprintf("line %d", i)})
+				if err != nil {
+					t.Fatalf("%s: %s", name, err)
+				}
+			}
+			w.Close()
+			files, _ := store.rotated("job")
+			if len(files) != test.rotated {
+				t.Errorf("%s: %d rotated files, want %d", name, len(files), test.rotated)
+			}
+			for _, file := range files {
+				if strings.HasSuffix(file, ".gz") != compress {
+					t.Errorf("%s: rotated file %s", name, filepath.Base(file))
+				}
+			}
+			msgs, err := store.Read("job", 1, 2)
+			if err != nil {
+				t.Fatalf("%s: %s", name, err)
+			}
+			if len(msgs) != 2 || msgs[0].Seq != 2 || msgs[1].Seq != 3 {
+				t.Errorf("%s: read %v", name, msgs)
+			}
+			all, _ := store.Read("job", 0, 0)
+			if len(all) != len(test.times) {
+				t.Errorf("%s: read %d messages, want %d", name, len(all), len(test.times))
+			}
+		}
+	}
+}
+
+func TestLogStoreRetention(t *testing.T){
+	store, err := NewLogStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.MaxSize = 1
+	store.Retention = time.Hour
+	w, _ := store.Writer("job")
+	w.Write(Message{Seq: 1, Time: time.Now(), Text: "a"})
+	w.Write(Message{Seq: 2, Time: time.Now(), Text: "b"})
+	w.Close()
+	files, _ := store.rotated("job")
+	if len(files) != 1 {
+		t.Fatalf("%d rotated files", len(files))
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(files[0], old, old); err != nil {
+		t.Fatal(err)
+	}
+	w, _ = store.Writer("job")
+	w.Close()
+	files, _ = store.rotated("job")
+	if len(files) != 0 {
+		t.Errorf("rotated files older than retention kept: %v", files)
+	}
+}
@@ -0,0 +1,290 @@
+///////////////////////////////////////////////////////////
+// pipeline.go
+// run ordered steps with conditions and retries
+// ycyxuehan kun1.huang@outlook.com
+//////////////////////////////////////////////////////////
+
+package shell
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+//step conditions
+const (
+	//IF_SUCCESS run the step if no step failed, it is the default
+	IF_SUCCESS = "success"
+	//IF_FAILURE run the step if a step failed
+	IF_FAILURE = "failure"
+	//IF_ALWAYS always run the step
+	IF_ALWAYS = "always"
+)
+
+//step results
+const (
+	STEP_SUCCEEDED = "succeeded"
+	STEP_FAILED = "failed"
+	STEP_SKIPPED = "skipped"
+)
+
+//Duration a time.Duration written as "10s" or "1m30s" in JSON and YAML
+type Duration time.Duration
+
+//MarshalJSON implement json.Marshaler
+func (d Duration)MarshalJSON()([]byte, error){
+	return json.Marshal(time.Duration(d).String())
+}
+
+//UnmarshalJSON implement json.Unmarshaler, a number means nanoseconds
+func (d *Duration)UnmarshalJSON(data []byte)error{
+	var v interface{}
+	err := json.Unmarshal(data, &v)
+	if err != nil {
+		return err
+	}
+	return d.set(v)
+}
+
+//UnmarshalYAML implement yaml.Unmarshaler
+func (d *Duration)UnmarshalYAML(unmarshal func(interface{}) error)error{
+	var v interface{}
+	err := unmarshal(&v)
+	if err != nil {
+		return err
+	}
+	return d.set(v)
+}
+
+func (d *Duration)set(v interface{})error{
+	switch value := v.(type) {
+	case nil:
+		*d = 0
+	case float64:
+		*d = Duration(value)
+	case int:
+		*d = Duration(value)
+	case string:
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		*d = Duration(duration)
+	default:
+		return fmt.Errorf("invalid duration %v", v)
+	}
+	return nil
+}
+
+//Step a step of a pipeline
+type Step struct {
+	Name string `json:"name" yaml:"name"`
+	Command string `json:"command" yaml:"command"`
+	//Env KEY=VALUE pairs merged over the pipeline env
+	Env []string `json:"env,omitempty" yaml:"env,omitempty"`
+	//Dir working directory, the pipeline dir if empty
+	Dir string `json:"dir,omitempty" yaml:"dir,omitempty"`
+	//Timeout timeout of each attempt, zero means no timeout
+	Timeout Duration `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	//Retries attempts after the first failed one
+	Retries int `json:"retries,omitempty" yaml:"retries,omitempty"`
+	//Backoff wait before the first retry, doubled for each next retry
+	Backoff Duration `json:"backoff,omitempty" yaml:"backoff,omitempty"`
+	//ContinueOnError a failure of the step does not fail the pipeline
+	ContinueOnError bool `json:"continueOnError,omitempty" yaml:"continueOnError,omitempty"`
+	//If IF_SUCCESS, IF_FAILURE, IF_ALWAYS or a command,
+	//a command is run only if no step failed and the step is run if the command succeeds
+	If string `json:"if,omitempty" yaml:"if,omitempty"`
+}
+
+//Pipeline ordered steps
+type Pipeline struct {
+	Name string `json:"name" yaml:"name"`
+	//Shell interpreter of the steps, BASH if empty
+	Shell string `json:"shell,omitempty" yaml:"shell,omitempty"`
+	Dir string `json:"dir,omitempty" yaml:"dir,omitempty"`
+	Env []string `json:"env,omitempty" yaml:"env,omitempty"`
+	Steps []Step `json:"steps" yaml:"steps"`
+	//OnStart called with the shell of each attempt before it starts, to subscribe its output
+	OnStart func(step *Step, attempt int, s *Shell) `json:"-" yaml:"-"`
+	//Redactor mask secrets in the output and errors of the steps
+	Redactor *Redactor `json:"-" yaml:"-"`
+}
+
+//StepReport the result of a step
+type StepReport struct {
+	Name string `json:"name"`
+	Status string `json:"status"`
+	Attempts int `json:"attempts"`
+	ExitCode int `json:"exitCode"`
+	Error string `json:"error,omitempty"`
+	Start time.Time `json:"start"`
+	Duration Duration `json:"duration"`
+	//Output the kept output of the last attempt
+	Output []Message `json:"output,omitempty"`
+}
+
+//PipelineReport the result of a pipeline
+type PipelineReport struct {
+	Name string `json:"name"`
+	Succeeded bool `json:"succeeded"`
+	Start time.Time `json:"start"`
+	Duration Duration `json:"duration"`
+	Steps []StepReport `json:"steps"`
+}
+
+//Failed the failed steps
+func (r *PipelineReport)Failed()[]StepReport{
+	steps := []StepReport{}
+	for _, step := range r.Steps {
+		if step.Status == STEP_FAILED {
+			steps = append(steps, step)
+		}
+	}
+	return steps
+}
+
+//ParsePipeline parse a pipeline from JSON
+func ParsePipeline(data []byte)(*Pipeline, error){
+	var p Pipeline
+	err := json.Unmarshal(data, &p)
+	if err != nil {
+		return nil, err
+	}
+	return &p, p.Validate()
+}
+
+//Validate check the steps
+func (p *Pipeline)Validate()error{
+	for i, step := range p.Steps {
+		if step.Command == "" {
+			return fmt.Errorf("step %d %s: command is empty", i, step.Name)
+		}
+		if step.Retries < 0 {
+			return fmt.Errorf("step %d %s: retries is negative", i, step.Name)
+		}
+	}
+	return nil
+}
+
+//newShell new a shell for a step
+func (p *Pipeline)newShell(step *Step)*Shell{
+	interpreter := p.Shell
+	if interpreter == "" {
+		interpreter = BASH
+	}
+	s := NewWithShell(interpreter)
+	s.Dir = p.Dir
+	if step.Dir != "" {
+		s.Dir = step.Dir
+	}
+	s.Env = append(append([]string{}, p.Env...), step.Env...)
+	s.Redactor = p.Redactor
+	return s
+}
+
+//Run run the steps in order, the pipeline fails if a step fails without ContinueOnError
+func (p *Pipeline)Run(ctx context.Context)*PipelineReport{
+	report := &PipelineReport{
+		Name: p.Name,
+		Start: time.Now(),
+		Steps: []StepReport{},
+	}
+	failed := false
+	anyFailed := false
+	for i := range p.Steps {
+		step := &p.Steps[i]
+		result := StepReport{
+			Name: step.Name,
+			Status: STEP_SKIPPED,
+			ExitCode: -1,
+			Start: time.Now(),
+		}
+		if ctx.Err() != nil {
+			result.Error = ctx.Err().Error()
+			report.Steps = append(report.Steps, result)
+			failed = true
+			continue
+		}
+		run, err := p.shouldRun(ctx, step, failed, anyFailed)
+		if err != nil {
+			result.Error = err.Error()
+		}
+		if run {
+			p.runStep(ctx, step, &result)
+			if result.Status == STEP_FAILED {
+				anyFailed = true
+				if !step.ContinueOnError {
+					failed = true
+				}
+			}
+		}
+		result.Duration = Duration(time.Since(result.Start))
+		report.Steps = append(report.Steps, result)
+	}
+	report.Succeeded = !failed
+	report.Duration = Duration(time.Since(report.Start))
+	return report
+}
+
+//shouldRun evaluate the condition of a step
+func (p *Pipeline)shouldRun(ctx context.Context, step *Step, failed bool, anyFailed bool)(bool, error){
+	switch step.If {
+	case "", IF_SUCCESS:
+		return !failed, nil
+	case IF_FAILURE:
+		return anyFailed, nil
+	case IF_ALWAYS:
+		return true, nil
+	}
+	if failed {
+		return false, nil
+	}
+	err := p.newShell(step).ExecContext(ctx, step.If)
+	if err != nil {
+		return false, fmt.Errorf("condition: %s", err.Error())
+	}
+	return true, nil
+}
+
+//runStep run a step with retries
+func (p *Pipeline)runStep(ctx context.Context, step *Step, result *StepReport){
+	backoff := time.Duration(step.Backoff)
+	for attempt := 1; attempt <= step.Retries+1; attempt++ {
+		if attempt > 1 && backoff > 0 {
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				result.Error = ctx.Err().Error()
+				return
+			}
+			backoff *= 2
+		}
+		result.Attempts = attempt
+		s := p.newShell(step)
+		if p.OnStart != nil {
+			p.OnStart(step, attempt, s)
+		}
+		attemptCtx := ctx
+		cancel := func(){}
+		if step.Timeout > 0 {
+			attemptCtx, cancel = context.WithTimeout(ctx, time.Duration(step.Timeout))
+		}
+		err := s.ExecContext(attemptCtx, step.Command)
+		cancel()
+		result.ExitCode = s.ExitCode()
+		result.Output = s.Output().Messages()
+		if err == nil {
+			result.Status = STEP_SUCCEEDED
+			result.Error = ""
+			return
+		}
+		result.Status = STEP_FAILED
+		result.Error = err.Error()
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
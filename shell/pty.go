@@ -0,0 +1,38 @@
+///////////////////////////////////////////////////////////
+// pty.go
+// run a command attached to a pseudo-terminal
+// ycyxuehan kun1.huang@outlook.com
+//////////////////////////////////////////////////////////
+
+package shell
+
+import (
+	"fmt"
+)
+
+//WindowSize the size of a terminal
+type WindowSize struct {
+	Rows uint16 `json:"rows"`
+	Cols uint16 `json:"cols"`
+}
+
+//DefaultWindowSize used when Shell.WindowSize is zero
+var DefaultWindowSize = WindowSize{Rows: 24, Cols: 80}
+
+//Resize change the terminal size of the running command in PTY mode
+func (s *Shell)Resize(rows uint16, cols uint16)error{
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.WindowSize = WindowSize{Rows: rows, Cols: cols}
+	if s.proc == nil || !s.PTY {
+		return fmt.Errorf("shell is not running in a pty")
+	}
+	return s.proc.Resize(s.WindowSize)
+}
+
+func (s *Shell)windowSize()WindowSize{
+	if s.WindowSize.Rows == 0 || s.WindowSize.Cols == 0 {
+		return DefaultWindowSize
+	}
+	return s.WindowSize
+}
@@ -0,0 +1,106 @@
+// +build linux
+
+///////////////////////////////////////////////////////////
+// pty_linux.go
+// pseudo-terminal on linux
+// ycyxuehan kun1.huang@outlook.com
+//////////////////////////////////////////////////////////
+
+package shell
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+	"unsafe"
+)
+
+func ioctl(fd uintptr, request uintptr, arg uintptr)error{
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, request, arg)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+//openPty open a pty master and its slave
+func openPty()(*os.File, *os.File, error){
+	ptmx, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	var unlock int32
+	err = ioctl(ptmx.Fd(), syscall.TIOCSPTLCK, uintptr(unsafe.Pointer(&unlock)))
+	if err != nil {
+		ptmx.Close()
+		return nil, nil, err
+	}
+	var n uint32
+	err = ioctl(ptmx.Fd(), syscall.TIOCGPTN, uintptr(unsafe.Pointer(&n)))
+	if err != nil {
+		ptmx.Close()
+		return nil, nil, err
+	}
+	tty, err := os.OpenFile("/dev/pts/"+strconv.FormatUint(uint64(n), 10), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		ptmx.Close()
+		return nil, nil, err
+	}
+	return ptmx, tty, nil
+}
+
+func setWindowSize(ptmx *os.File, size WindowSize)error{
+	ws := struct {
+		Row uint16
+		Col uint16
+		X uint16
+		Y uint16
+	}{Row: size.Rows, Col: size.Cols}
+	return ioctl(ptmx.Fd(), syscall.TIOCSWINSZ, uintptr(unsafe.Pointer(&ws)))
+}
+
+//startPty start the command with a pty as its controlling terminal and stdio, the master is returned
+func startPty(command *exec.Cmd, size WindowSize)(*os.File, error){
+	ptmx, tty, err := openPty()
+	if err != nil {
+		return nil, err
+	}
+	defer tty.Close()
+	err = setWindowSize(ptmx, size)
+	if err != nil {
+		ptmx.Close()
+		return nil, err
+	}
+	command.Stdin = tty
+	command.Stdout = tty
+	command.Stderr = tty
+	if command.SysProcAttr == nil {
+		command.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	//a session leader leads its own process group already
+	command.SysProcAttr.Setpgid = false
+	command.SysProcAttr.Setsid = true
+	command.SysProcAttr.Setctty = true
+	command.SysProcAttr.Ctty = 0
+	err = command.Start()
+	if err != nil {
+		ptmx.Close()
+		return nil, err
+	}
+	return ptmx, nil
+}
+
+//ptyReader read the pty master, EIO after the slave is closed or a closed master means EOF
+type ptyReader struct {
+	ptmx *os.File
+}
+
+func (r ptyReader)Read(p []byte)(int, error){
+	n, err := r.ptmx.Read(p)
+	if pathErr, ok := err.(*os.PathError); ok && (pathErr.Err == syscall.EIO || pathErr.Err == os.ErrClosed) {
+		err = io.EOF
+	}
+	return n, err
+}
@@ -0,0 +1,32 @@
+// +build !linux
+
+///////////////////////////////////////////////////////////
+// pty_other.go
+// pseudo-terminal is not supported
+// ycyxuehan kun1.huang@outlook.com
+//////////////////////////////////////////////////////////
+
+package shell
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+func setWindowSize(ptmx *os.File, size WindowSize)error{
+	return fmt.Errorf("pty is not supported on %s", runtime.GOOS)
+}
+
+func startPty(command *exec.Cmd, size WindowSize)(*os.File, error){
+	return nil, fmt.Errorf("pty is not supported on %s", runtime.GOOS)
+}
+
+type ptyReader struct {
+	ptmx *os.File
+}
+
+func (r ptyReader)Read(p []byte)(int, error){
+	return r.ptmx.Read(p)
+}
@@ -0,0 +1,146 @@
+///////////////////////////////////////////////////////////
+// redact.go
+// mask secrets in command output
+// ycyxuehan kun1.huang@outlook.com
+//////////////////////////////////////////////////////////
+
+package shell
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//REDACTED the default replacement of a secret
+const REDACTED = "******"
+
+//MAX_RAW_PENDING raw bytes held back waiting for a line end before they are redacted and written anyway
+const MAX_RAW_PENDING = 4096
+
+//Redactor replace secrets and patterns in text, a nil Redactor does nothing
+type Redactor struct {
+	mu sync.RWMutex
+	secrets []string
+	patterns []*regexp.Regexp
+	replacement string
+}
+
+//NewRedactor new a redactor, replacement defaults to REDACTED
+func NewRedactor(replacement string)*Redactor{
+	if replacement == "" {
+		replacement = REDACTED
+	}
+	return &Redactor{replacement: replacement}
+}
+
+//AddSecret add secret values, empty values are ignored
+func (r *Redactor)AddSecret(secrets ...string){
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, secret := range secrets {
+		if secret != "" {
+			r.secrets = append(r.secrets, secret)
+		}
+	}
+	//replace the longest first, so a secret containing another is masked as a whole
+	sort.SliceStable(r.secrets, func(i, j int)bool{
+		return len(r.secrets[i]) > len(r.secrets[j])
+	})
+}
+
+//AddPattern add regexps, every match is replaced
+func (r *Redactor)AddPattern(patterns ...*regexp.Regexp){
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.patterns = append(r.patterns, patterns...)
+}
+
+//AddRegexp compile and add a regexp
+func (r *Redactor)AddRegexp(expr string)error{
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return err
+	}
+	r.AddPattern(re)
+	return nil
+}
+
+//Redact replace the secrets and patterns in text
+func (r *Redactor)Redact(text string)string{
+	if r == nil {
+		return text
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, secret := range r.secrets {
+		text = strings.Replace(text, secret, r.replacement, -1)
+	}
+	for _, re := range r.patterns {
+		text = re.ReplaceAllLiteralString(text, r.replacement)
+	}
+	return text
+}
+
+//Error redact the message of err
+func (r *Redactor)Error(err error)error{
+	if r == nil || err == nil {
+		return err
+	}
+	msg := r.Redact(err.Error())
+	if msg == err.Error() {
+		return err
+	}
+	return errors.New(msg)
+}
+
+//Writer redact the bytes written to w.
+//Bytes are held back until a line end or MAX_RAW_PENDING bytes, so a secret in a line is masked even if it is written in pieces.
+func (r *Redactor)Writer(w io.Writer)*RedactWriter{
+	return &RedactWriter{redactor: r, w: w}
+}
+
+//RedactWriter an io.Writer redacting its input, Flush writes the held back bytes
+type RedactWriter struct {
+	mu sync.Mutex
+	redactor *Redactor
+	w io.Writer
+	pending []byte
+}
+
+//Write implement io.Writer
+func (rw *RedactWriter)Write(p []byte)(int, error){
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	rw.pending = append(rw.pending, p...)
+	end := bytes.LastIndexAny(rw.pending, "\r\n") + 1
+	if end == 0 && len(rw.pending) >= MAX_RAW_PENDING {
+		end = len(rw.pending)
+	}
+	if end == 0 {
+		return len(p), nil
+	}
+	err := rw.write(end)
+	return len(p), err
+}
+
+//Flush write the held back bytes
+func (rw *RedactWriter)Flush()error{
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	return rw.write(len(rw.pending))
+}
+
+func (rw *RedactWriter)write(end int)error{
+	if end == 0 {
+		return nil
+	}
+	text := rw.redactor.Redact(string(rw.pending[:end]))
+	rw.pending = append(rw.pending[:0], rw.pending[end:]...)
+	_, err := io.WriteString(rw.w, text)
+	return err
+}
@@ -0,0 +1,27 @@
+package shell
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type failingExecutor struct{}
+
+func (failingExecutor)Start(ctx context.Context, c *Command)(Process, error){
+	return nil, fmt.Errorf("get pid error: token=hunter2")
+}
+
+func TestRedactStartError(t *testing.T){
+	s := NewWithShell(SH)
+	s.Executor = failingExecutor{}
+	s.Redactor = NewRedactor("")
+	s.Redactor.AddSecret("hunter2")
+	errs := map[string]error{"exec": s.Exec("true"), "wait": s.Wait()}
+	for name, err := range errs {
+		if err == nil || strings.Contains(err.Error(), "hunter2") {
+			t.Errorf("%s error %v", name, err)
+		}
+	}
+}
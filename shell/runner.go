@@ -0,0 +1,246 @@
+///////////////////////////////////////////////////////////
+// runner.go
+// run commands in the background
+// ycyxuehan kun1.huang@outlook.com
+//////////////////////////////////////////////////////////
+
+package shell
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//Job a command started by a runner
+type Job struct {
+	ID string `json:"id"`
+	Cmd string `json:"cmd"`
+	Created time.Time `json:"created"`
+	//Log the name of the job log in the runner store
+	Log string `json:"log,omitempty"`
+	Shell *Shell `json:"-"`
+	logDone chan struct{}
+	logErr error
+}
+
+//GetStatus get the status of the job
+func (j *Job)GetStatus()ShellStatus{
+	return j.Shell.GetStatus()
+}
+
+//Runner run commands in the background with a max concurrency
+type Runner struct {
+	//Store record the output of every job if it is not nil
+	Store *LogStore
+	mu sync.Mutex
+	slots chan struct{}
+	jobs map[string]*Job
+	order []string
+	seq uint64
+}
+
+//NewRunner new a runner, maxConcurrency <= 0 means no limit
+func NewRunner(maxConcurrency int)*Runner{
+	r := &Runner{
+		jobs: make(map[string]*Job),
+	}
+	if maxConcurrency > 0 {
+		r.slots = make(chan struct{}, maxConcurrency)
+	}
+	return r
+}
+
+//Run run a command with a new shell, the job ID is returned
+func (r *Runner)Run(args ...string)(string, error){
+	return r.Submit(New(), args...)
+}
+
+//Submit run a command with a configured shell, the job ID is returned.
+//The job waits in WAIT status until a slot is free.
+func (r *Runner)Submit(s *Shell, args ...string)(string, error){
+	cmd := strings.Join(args, " ")
+	if cmd == "" {
+		return "", fmt.Errorf("cmd is empty")
+	}
+	if s == nil {
+		return "", fmt.Errorf("shell is nil")
+	}
+	err := s.queue()
+	if err != nil {
+		return "", err
+	}
+	r.mu.Lock()
+	r.seq++
+	job := &Job{
+		ID: strconv.FormatUint(r.seq, 10),
+		Cmd: cmd,
+		Created: time.Now(),
+		Shell: s,
+	}
+	store := r.Store
+	if store != nil {
+		job.Log = job.Created.Format("20060102150405") + "-" + job.ID
+		job.logDone = make(chan struct{})
+	}
+	r.jobs[job.ID] = job
+	r.order = append(r.order, job.ID)
+	r.mu.Unlock()
+	if store != nil {
+		result, err := store.Record(job.Log, s.Output())
+		if err != nil {
+			job.logErr = err
+			close(job.logDone)
+			s.cancel(fmt.Errorf("record job log error: %s", err.Error()))
+			return job.ID, err
+		}
+		go func(){
+			job.logErr = <-result
+			close(job.logDone)
+		}()
+	}
+	go r.run(job, args)
+	return job.ID, nil
+}
+
+func (r *Runner)run(job *Job, args []string){
+	if r.slots != nil {
+		select {
+		case r.slots <- struct{}{}:
+		case <-job.Shell.Done():
+			//cancelled while waiting
+			return
+		}
+		defer func(){ <-r.slots }()
+	}
+	if job.Shell.start(context.Background(), true, args...) != nil {
+		return
+	}
+	job.Shell.Wait()
+}
+
+//Jobs list the jobs in submitted order
+func (r *Runner)Jobs()[]*Job{
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	jobs := make([]*Job, 0, len(r.order))
+	for _, id := range r.order {
+		jobs = append(jobs, r.jobs[id])
+	}
+	return jobs
+}
+
+//Job get a job by ID
+func (r *Runner)Job(ID string)(*Job, error){
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job, ok := r.jobs[ID]
+	if !ok {
+		return nil, fmt.Errorf("job %s not found", ID)
+	}
+	return job, nil
+}
+
+//Status get the status of a job
+func (r *Runner)Status(ID string)(ShellStatus, error){
+	job, err := r.Job(ID)
+	if err != nil {
+		return UNKOWN, err
+	}
+	return job.GetStatus(), nil
+}
+
+//Output get the kept output of a job
+func (r *Runner)Output(ID string)([]Message, error){
+	job, err := r.Job(ID)
+	if err != nil {
+		return nil, err
+	}
+	return job.Shell.Output().Messages(), nil
+}
+
+//Tail get the last n lines of the kept output of a job
+func (r *Runner)Tail(ID string, n int)([]Message, error){
+	msgs, err := r.Output(ID)
+	if err != nil {
+		return nil, err
+	}
+	if n >= 0 && len(msgs) > n {
+		msgs = msgs[len(msgs)-n:]
+	}
+	return msgs, nil
+}
+
+//Log read the stored log of a job, see LogStore.Read
+func (r *Runner)Log(ID string, offset int, limit int)([]Message, error){
+	job, err := r.Job(ID)
+	if err != nil {
+		return nil, err
+	}
+	if r.Store == nil || job.Log == "" {
+		return nil, fmt.Errorf("job %s has no stored log", ID)
+	}
+	return r.Store.Read(job.Log, offset, limit)
+}
+
+//Follow subscribe the output of a job, the kept output is delivered first
+func (r *Runner)Follow(ID string)(*Subscription, error){
+	job, err := r.Job(ID)
+	if err != nil {
+		return nil, err
+	}
+	return job.Shell.Output().Subscribe(true), nil
+}
+
+//Signal send a signal to a job, a waiting job is cancelled
+func (r *Runner)Signal(ID string, sig os.Signal)error{
+	job, err := r.Job(ID)
+	if err != nil {
+		return err
+	}
+	if job.Shell.cancel(fmt.Errorf("job cancelled by signal %s", sig.String())) {
+		return nil
+	}
+	return job.Shell.Signal(sig)
+}
+
+//Wait wait for a job to finish and its log to be stored, the error of the job is returned
+func (r *Runner)Wait(ID string)error{
+	job, err := r.Job(ID)
+	if err != nil {
+		return err
+	}
+	err = job.Shell.Wait()
+	if job.logDone != nil {
+		<-job.logDone
+		if err == nil && job.logErr != nil {
+			err = fmt.Errorf("record job log error: %s", job.logErr.Error())
+		}
+	}
+	return err
+}
+
+//Remove remove a finished job
+func (r *Runner)Remove(ID string)error{
+	job, err := r.Job(ID)
+	if err != nil {
+		return err
+	}
+	if !job.GetStatus().Finished() {
+		return fmt.Errorf("job %s is %s", ID, job.GetStatus().String())
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.jobs, ID)
+	for i, id := range r.order {
+		if id == ID {
+			r.order = append(r.order[:i], r.order[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
@@ -7,104 +7,536 @@
 package shell
 
 import (
+	"context"
 	"io"
 	"bufio"
-	"os/exec"
+	"os"
 	"fmt"
 	"strings"
+	"sync"
+	"time"
 
 )
 
-type ShellStatus int
+//MAX_POOL_SIZE size of PipLine
+const MAX_POOL_SIZE = 100
 
+//interpreters
 const (
-	MAX_POOL_SIZE = 100
-	
-	CREATED = iota
-	STARTED
-	RUNNING
-	EXITED
-	ERROR
-	UNKOWN
-	WAIT
+	SH = "/bin/sh"
+	BASH = "/bin/bash"
+	ZSH = "/bin/zsh"
 )
 
-func (s *ShellStatus)ToString()string{
-	switch *s {
-	case CREATED: return "created"
-	case STARTED: return "started"
-	case RUNNING: return "running"
-	case EXITED: return "exited"
-	case ERROR: return "error"
-	}
-	return "unkown"
-}
+//EnvMode how Shell.Env is applied to the command environment
+type EnvMode int
 
+const (
+	//ENV_MERGE the current environment overridden by Env
+	ENV_MERGE EnvMode = iota
+	//ENV_INHERIT the current environment only, Env is ignored
+	ENV_INHERIT
+	//ENV_REPLACE Env only
+	ENV_REPLACE
+)
 
+//Shell run a command with an interpreter, it is safe for concurrent use
 type Shell struct {
+	mu sync.Mutex
 	shell string
-	Status ShellStatus
+	shellArgs []string
+	status ShellStatus
+	pid int
+	proc Process
+	exitCode int
+	limitResult LimitResult
+	err error
+	done chan struct{}
+	watchers []func(StatusEvent)
+	handlers []LineHandler
+	//sendMu serialize the lines of stdout and stderr, so handlers are called one at a time in the order of the output
+	sendMu sync.Mutex
+	output *Broker
+	next *Broker
+	//PipLine the latest MAX_POOL_SIZE lines, older lines are dropped. Use Subscribe to receive every line.
 	PipLine chan string
-	Pid int
+	//Dir working directory of the command, empty means the current directory
+	Dir string
+	//Env environment in KEY=VALUE form, applied according to EnvMode
+	Env []string
+	EnvMode EnvMode
+	//Stdin standard input of the command, nil means no input
+	Stdin io.Reader
+	//PTY run the command attached to a pseudo-terminal, stdout and stderr are merged
+	PTY bool
+	//WindowSize the terminal size in PTY mode, zero means DefaultWindowSize
+	WindowSize WindowSize
+	//RawOutput receive the raw bytes of the output in PTY mode
+	RawOutput io.Writer
+	//Limits resource limits of the command, nil means no limit
+	Limits *Limits
+	//Redactor mask secrets in the output and errors before they reach PipLine, subscribers and RawOutput
+	Redactor *Redactor
+	//Executor where the command is executed, nil means LocalExecutor
+	Executor Executor
 }
 
 func New()*Shell{
-	return &Shell{
-		shell: "/bin/bash",
-		Status: UNKOWN,
+	return NewWithShell(BASH)
+}
+
+//NewWithShell new a shell with an interpreter, args default to -c
+func NewWithShell(interpreter string, args ...string)*Shell{
+	s := &Shell{
+		status: UNKOWN,
 		PipLine: make(chan string, MAX_POOL_SIZE),
+		output: NewBroker(DEFAULT_BUFFER_SIZE),
 	}
+	s.SetShell(interpreter, args...)
+	return s
+}
+
+//SetShell set the interpreter and the args put before the command, args default to -c
+func (s *Shell)SetShell(interpreter string, args ...string){
+	if len(args) == 0 {
+		args = []string{"-c"}
+	}
+	s.shell = interpreter
+	s.shellArgs = args
+}
+
+//SetEnv set an environment variable
+func (s *Shell)SetEnv(key string, value string){
+	prefix := key + "="
+	for i, e := range s.Env {
+		if strings.HasPrefix(e, prefix) {
+			s.Env[i] = prefix + value
+			return
+		}
+	}
+	s.Env = append(s.Env, prefix+value)
+}
+
+//SetStdinString use a string as stdin
+func (s *Shell)SetStdinString(input string){
+	s.Stdin = strings.NewReader(input)
 }
 
-//Exec exec a shell cmd.
+//Exec exec a shell cmd and wait for it.
 func(s *Shell)Exec(args... string)error{
+	return s.ExecContext(context.Background(), args...)
+}
+
+//ExecContext exec a shell cmd and wait for it, the command is killed when ctx is done
+func (s *Shell)ExecContext(ctx context.Context, args ...string)error{
+	err := s.StartContext(ctx, args...)
+	if err != nil {
+		return err
+	}
+	return s.Wait()
+}
+
+//Start start a shell cmd without waiting for it
+func (s *Shell)Start(args ...string)error{
+	return s.start(context.Background(), false, args...)
+}
+
+//StartContext start a shell cmd without waiting for it, the command is killed when ctx is done
+func (s *Shell)StartContext(ctx context.Context, args ...string)error{
+	return s.start(ctx, false, args...)
+}
+
+//start start a shell cmd, the shell must be waiting if queued is true
+func (s *Shell)start(ctx context.Context, queued bool, args ...string)error{
 	cmd :=  strings.Join(args, " ")
 	if cmd == "" {
 		return fmt.Errorf("cmd is empty")
 	}
+	s.mu.Lock()
+	if (queued && s.status != WAIT) || !s.status.CanTransit(CREATED) {
+		status := s.status
+		s.mu.Unlock()
+		return fmt.Errorf("shell is %s", status.String())
+	}
 	if s.shell == ""{
-		s.shell = "/bin/bash"
+		s.SetShell(BASH)
+	}
+	command := &Command{
+		Path: s.shell,
+		Args: append(append([]string{}, s.shellArgs...), cmd),
+		Dir: s.Dir,
+		Env: append([]string(nil), s.Env...),
+		EnvMode: s.EnvMode,
+		Stdin: s.Stdin,
+		PTY: s.PTY,
+		WindowSize: s.windowSize(),
+		Limits: s.Limits,
+	}
+	executor := s.Executor
+	if executor == nil {
+		executor = LocalExecutor{}
 	}
-	command := exec.Command(s.shell, "-c", cmd)
-	s.Status = CREATED
-	stdout, err := command.StdoutPipe()
+	raw := s.RawOutput
+	redactor := s.Redactor
+	s.reset()
+	output := s.output
+	//checked and changed in one critical section, so only one caller starts a command
+	event, watchers := s.transit(CREATED)
+	s.mu.Unlock()
+	notify(watchers, event)
+
+	proc, err := executor.Start(ctx, command)
 	if err != nil {
-		s.Status = ERROR
-		return err
+		//the error may contain the output of the command
+		return s.finish(err)
+	}
+	s.mu.Lock()
+	s.pid = proc.Pid()
+	s.proc = proc
+	s.mu.Unlock()
+	if !s.setStatus(STARTED) || !s.setStatus(RUNNING) {
+		//the status is owned by this run, a failed change is a bug
+		proc.Signal(os.Kill)
+		proc.Wait()
+		return s.finish(fmt.Errorf("shell is %s", s.GetStatus().String()))
+	}
+
+	readers := map[string]io.Reader{}
+	var rawWriter *RedactWriter
+	if command.PTY && raw != nil {
+		if redactor != nil {
+			rawWriter = redactor.Writer(raw)
+			raw = rawWriter
+		}
+		readers[STDOUT] = io.TeeReader(proc.Stdout(), raw)
+	} else if proc.Stdout() != nil {
+		readers[STDOUT] = proc.Stdout()
 	}
-	err = command.Start()
-	s.Status = STARTED
+	if proc.Stderr() != nil {
+		readers[STDERR] = proc.Stderr()
+	}
+	go func(){
+		var wg sync.WaitGroup
+		wg.Add(len(readers))
+		for stream, reader := range readers {
+			go s.readLines(&wg, output, stream, reader)
+		}
+		wg.Wait()
+		if rawWriter != nil {
+			rawWriter.Flush()
+		}
+
+		status, err := proc.Wait()
+		if status == nil {
+			status = &ExitStatus{Code: -1, Message: "unknown"}
+			if err != nil {
+				status.Message = err.Error()
+			}
+		}
+		if err != nil || !status.Success() {
+			err = fmt.Errorf("command exec failed: %s", status.Message)
+			if ctx.Err() != nil {
+				err = fmt.Errorf("command exec failed: %s: %s", status.Message, ctx.Err().Error())
+			}
+			if status.Limits.Hit() {
+				err = fmt.Errorf("%s (%s)", err.Error(), status.Limits.String())
+			}
+		}
+		s.mu.Lock()
+		s.exitCode = status.Code
+		s.limitResult = status.Limits
+		s.proc = nil
+		s.mu.Unlock()
+		s.finish(err)
+	}()
+	return nil
+}
+
+//reset prepare the output and done channel for a new run, s.mu must be held
+func (s *Shell)reset(){
+	if s.done == nil || isClosed(s.done) {
+		s.done = make(chan struct{})
+	}
+	if s.next != nil {
+		s.output = s.next
+		s.next = nil
+	} else if s.output == nil || s.output.Closed() {
+		s.output = NewBroker(DEFAULT_BUFFER_SIZE)
+	}
+	s.err = nil
+	s.pid = 0
+	s.proc = nil
+	s.exitCode = -1
+	s.limitResult = LimitResult{}
+}
+
+//queue mark the shell as waiting to be started
+func (s *Shell)queue()error{
+	s.mu.Lock()
+	if !s.status.CanTransit(WAIT) {
+		status := s.status
+		s.mu.Unlock()
+		return fmt.Errorf("shell is %s", status.String())
+	}
+	s.reset()
+	event, watchers := s.transit(WAIT)
+	s.mu.Unlock()
+	notify(watchers, event)
+	return nil
+}
+
+//cancel finish a waiting shell with err, false is returned if it is not waiting
+func (s *Shell)cancel(err error)bool{
+	s.mu.Lock()
+	if s.status != WAIT {
+		s.mu.Unlock()
+		return false
+	}
+	event, watchers := s.transit(ERROR)
+	s.err = err
+	output := s.output
+	done := s.done
+	s.mu.Unlock()
+	notify(watchers, event)
+	output.Close()
+	close(done)
+	return true
+}
+
+//Signal send a signal to the running command
+func (s *Shell)Signal(sig os.Signal)error{
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.status != RUNNING || s.proc == nil {
+		return fmt.Errorf("shell is %s", s.status.String())
+	}
+	return s.proc.Signal(sig)
+}
+
+//finish finish the current run with err, the redacted err is returned
+func (s *Shell)finish(err error)error{
+	s.mu.Lock()
+	err = s.Redactor.Error(err)
+	s.err = err
+	output := s.output
+	done := s.done
+	s.mu.Unlock()
 	if err != nil {
-		s.Status = ERROR
-		return err
+		s.setStatus(ERROR)
+	} else {
+		s.setStatus(EXITED)
+	}
+	output.Close()
+	close(done)
+	return err
+}
+
+func isClosed(ch chan struct{})bool{
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+//setStatus change the status and notify the watchers, false is returned if the change is not allowed
+func (s *Shell)setStatus(status ShellStatus)bool{
+	s.mu.Lock()
+	if !s.status.CanTransit(status) {
+		s.mu.Unlock()
+		return false
+	}
+	event, watchers := s.transit(status)
+	s.mu.Unlock()
+	notify(watchers, event)
+	return true
+}
+
+//transit change the status without checking it, s.mu must be held.
+//The watchers are returned to be notified after s.mu is released.
+func (s *Shell)transit(status ShellStatus)(StatusEvent, []func(StatusEvent)){
+	event := StatusEvent{From: s.status, To: status, Time: time.Now()}
+	s.status = status
+	return event, s.watchers
+}
+
+//notify call the watchers with a status change
+func notify(watchers []func(StatusEvent), event StatusEvent){
+	for _, watcher := range watchers {
+		watcher(event)
+	}
+}
+
+//GetStatus get the status
+func (s *Shell)GetStatus()ShellStatus{
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
+}
+
+//GetPid get the pid of the current or last command
+func (s *Shell)GetPid()int{
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pid
+}
+
+//ExitCode the exit code of the last command, -1 if it is not exited or killed by a signal
+func (s *Shell)ExitCode()int{
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.status.Finished() {
+		return -1
+	}
+	return s.exitCode
+}
+
+//GetLimitResult which limits were hit by the last command
+func (s *Shell)GetLimitResult()LimitResult{
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.limitResult
+}
+
+//Wait wait for the command to finish and return its error
+func (s *Shell)Wait()error{
+	s.mu.Lock()
+	if s.status == UNKOWN {
+		s.mu.Unlock()
+		return fmt.Errorf("shell is not started")
+	}
+	done := s.done
+	s.mu.Unlock()
+	<-done
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+//Done a channel closed when the current or next command finished
+func (s *Shell)Done()<-chan struct{}{
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.done == nil || (isClosed(s.done) && !s.status.Finished()) {
+		s.done = make(chan struct{})
 	}
-	s.Pid = command.Process.Pid
-	s.Status = RUNNING
-	reader := bufio.NewReader(stdout)
+	return s.done
+}
+
+//OnStatusChange call fn on every status change, fn must not block
+func (s *Shell)OnStatusChange(fn func(StatusEvent)){
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.watchers = append(s.watchers, fn)
+}
+
+//Watch receive the status changes, the oldest event is dropped if the receiver is MAX_POOL_SIZE events behind
+func (s *Shell)Watch()<-chan StatusEvent{
+	ch := make(chan StatusEvent, MAX_POOL_SIZE)
+	s.OnStatusChange(func(event StatusEvent){
+		for {
+			select {
+			case ch <- event:
+				return
+			default:
+			}
+			select {
+			case <-ch:
+			default:
+			}
+		}
+	})
+	return ch
+}
+
+//readLines read lines from a stream and send them
+func (s *Shell)readLines(wg *sync.WaitGroup, output *Broker, stream string, r io.Reader){
+	defer wg.Done()
+	reader := bufio.NewReader(r)
 	for {
-		line, err2 := reader.ReadString('\n')
-		if err2 != nil || err2 == io.EOF {
-			if err2 != io.EOF {
-				s.SendMsg(err2.Error())
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			s.send(output, stream, line)
+		}
+		if err != nil {
+			if err != io.EOF {
+				s.send(output, STDERR, err.Error())
 			}
-			break
+			return
 		}
-		s.SendMsg(line)
 	}
+}
 
-	err = command.Wait()
-	if err != nil || command.ProcessState.Success() == false {
-		s.Status = ERROR
-		return fmt.Errorf("command exec failed: %s", command.ProcessState.String())
+//send publish a line to the broker and the PipLine
+func (s *Shell)send(output *Broker, stream string, line string){
+	line = s.Redactor.Redact(line)
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	msg := output.Publish(stream, strings.TrimRight(line, "\r\n"))
+	s.pipe(line)
+	s.handle(msg)
+}
+
+//Output the output broker of the current or last command
+func (s *Shell)Output()*Broker{
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.output == nil {
+		s.output = NewBroker(DEFAULT_BUFFER_SIZE)
 	}
-	s.Status = EXITED
-	return err
+	return s.output
+}
+
+//nextOutput the output broker of the current command, or of the next one if the last command is finished
+func (s *Shell)nextOutput()*Broker{
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.output == nil {
+		s.output = NewBroker(DEFAULT_BUFFER_SIZE)
+	}
+	if !s.output.Closed() {
+		return s.output
+	}
+	if s.next == nil {
+		s.next = NewBroker(DEFAULT_BUFFER_SIZE)
+	}
+	return s.next
+}
+
+//Subscribe subscribe the output of the current or next command, the kept lines are delivered first if replay is true.
+//Use Output().Subscribe to read the output of a finished command.
+func (s *Shell)Subscribe(replay bool)*Subscription{
+	return s.nextOutput().Subscribe(replay)
 }
 
 //SendMsg send msg
 func (s *Shell)SendMsg(msg string){
-	if len(s.PipLine) == MAX_POOL_SIZE {
-		<- s.PipLine
+	msg = s.Redactor.Redact(msg)
+	output := s.Output()
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	if !output.Closed() {
+		line := output.Publish(STDOUT, strings.TrimRight(msg, "\r\n"))
+		s.handle(line)
+	}
+	s.pipe(msg)
+}
+
+//pipe put msg to PipLine, the oldest msg is dropped if it is full
+func (s *Shell)pipe(msg string){
+	if s.PipLine == nil {
+		return
 	}
-	s.PipLine <- msg
-}
\ No newline at end of file
+	for {
+		select {
+		case s.PipLine <- msg:
+			return
+		default:
+		}
+		select {
+		case <-s.PipLine:
+		default:
+		}
+	}
+}
@@ -0,0 +1,395 @@
+///////////////////////////////////////////////////////////
+// ssh.go
+// execute commands on a remote host over ssh
+// ycyxuehan kun1.huang@outlook.com
+//////////////////////////////////////////////////////////
+
+package shell
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+//SSHConfig how to connect to a host
+type SSHConfig struct {
+	//Addr host or host:port, port 22 if it is omitted
+	Addr string
+	User string
+	Password string
+	//KeyFile path of a private key
+	KeyFile string
+	//Key a PEM encoded private key
+	Key []byte
+	//KeyPassphrase passphrase of an encrypted key
+	KeyPassphrase string
+	//UseAgent authenticate with the keys of the agent at SSH_AUTH_SOCK
+	UseAgent bool
+	//KnownHostsFile verify the host key, ~/.ssh/known_hosts if it is empty
+	KnownHostsFile string
+	//HostKeyCallback verify the host key instead of KnownHostsFile
+	HostKeyCallback ssh.HostKeyCallback
+	//Timeout timeout of the tcp connection
+	Timeout time.Duration
+	//JumpHosts the hosts to connect through, in order
+	JumpHosts []*SSHConfig
+}
+
+func (c *SSHConfig)addr()string{
+	if _, _, err := net.SplitHostPort(c.Addr); err == nil {
+		return c.Addr
+	}
+	return net.JoinHostPort(c.Addr, "22")
+}
+
+//clientConfig build the ssh client config, the agent connection is returned to be closed
+func (c *SSHConfig)clientConfig()(*ssh.ClientConfig, io.Closer, error){
+	auths := []ssh.AuthMethod{}
+	var agentConn net.Conn
+	if c.UseAgent {
+		sock := os.Getenv("SSH_AUTH_SOCK")
+		if sock == "" {
+			return nil, nil, fmt.Errorf("SSH_AUTH_SOCK is empty")
+		}
+		conn, err := net.Dial("unix", sock)
+		if err != nil {
+			return nil, nil, fmt.Errorf("connect ssh agent error: %s", err.Error())
+		}
+		agentConn = conn
+		auths = append(auths, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+	}
+	key := c.Key
+	if len(key) == 0 && c.KeyFile != "" {
+		data, err := ioutil.ReadFile(c.KeyFile)
+		if err != nil {
+			closeConn(agentConn)
+			return nil, nil, err
+		}
+		key = data
+	}
+	if len(key) > 0 {
+		var signer ssh.Signer
+		var err error
+		if c.KeyPassphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(key, []byte(c.KeyPassphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey(key)
+		}
+		if err != nil {
+			closeConn(agentConn)
+			return nil, nil, fmt.Errorf("parse private key error: %s", err.Error())
+		}
+		auths = append(auths, ssh.PublicKeys(signer))
+	}
+	if c.Password != "" {
+		auths = append(auths, ssh.Password(c.Password))
+	}
+	hostKeyCallback := c.HostKeyCallback
+	if hostKeyCallback == nil {
+		file := c.KnownHostsFile
+		if file == "" {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				closeConn(agentConn)
+				return nil, nil, err
+			}
+			file = filepath.Join(home, ".ssh", "known_hosts")
+		}
+		callback, err := knownhosts.New(file)
+		if err != nil {
+			closeConn(agentConn)
+			return nil, nil, fmt.Errorf("load known hosts error: %s", err.Error())
+		}
+		hostKeyCallback = callback
+	}
+	config := &ssh.ClientConfig{
+		User: c.User,
+		Auth: auths,
+		HostKeyCallback: hostKeyCallback,
+		Timeout: c.Timeout,
+	}
+	if agentConn == nil {
+		return config, nil, nil
+	}
+	return config, agentConn, nil
+}
+
+func closeConn(conn net.Conn){
+	if conn != nil {
+		conn.Close()
+	}
+}
+
+//SSHExecutor run commands on a remote host, it implements Executor.
+//The remote host must have /bin/sh.
+type SSHExecutor struct {
+	Config *SSHConfig
+	mu sync.Mutex
+	client *ssh.Client
+	closers []io.Closer
+}
+
+//NewSSHExecutor new an executor connecting to a host at the first command
+func NewSSHExecutor(config *SSHConfig)*SSHExecutor{
+	return &SSHExecutor{Config: config}
+}
+
+//NewSSHExecutorWithClient new an executor with a connected client, Close closes it
+func NewSSHExecutorWithClient(client *ssh.Client)*SSHExecutor{
+	return &SSHExecutor{client: client, closers: []io.Closer{client}}
+}
+
+//Connect connect to the host through the jump hosts, it is done by the first command if it is not called
+func (e *SSHExecutor)Connect()error{
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, err := e.connect()
+	return err
+}
+
+func (e *SSHExecutor)connect()(*ssh.Client, error){
+	if e.client != nil {
+		return e.client, nil
+	}
+	if e.Config == nil {
+		return nil, fmt.Errorf("ssh config is nil")
+	}
+	hops := append(append([]*SSHConfig{}, e.Config.JumpHosts...), e.Config)
+	var client *ssh.Client
+	closers := []io.Closer{}
+	for _, hop := range hops {
+		config, agentConn, err := hop.clientConfig()
+		if err != nil {
+			closeAll(closers)
+			return nil, err
+		}
+		if agentConn != nil {
+			closers = append(closers, agentConn)
+		}
+		addr := hop.addr()
+		var conn net.Conn
+		if client == nil {
+			conn, err = net.DialTimeout("tcp", addr, hop.Timeout)
+		} else {
+			conn, err = client.Dial("tcp", addr)
+		}
+		if err != nil {
+			closeAll(closers)
+			return nil, fmt.Errorf("connect %s error: %s", addr, err.Error())
+		}
+		clientConn, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+		if err != nil {
+			conn.Close()
+			closeAll(closers)
+			return nil, fmt.Errorf("connect %s error: %s", addr, err.Error())
+		}
+		client = ssh.NewClient(clientConn, chans, reqs)
+		closers = append(closers, client)
+	}
+	e.client = client
+	e.closers = closers
+	return client, nil
+}
+
+//closeAll close in reverse order
+func closeAll(closers []io.Closer){
+	for i := len(closers) - 1; i >= 0; i-- {
+		closers[i].Close()
+	}
+}
+
+//Close close the connections
+func (e *SSHExecutor)Close()error{
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	closeAll(e.closers)
+	e.closers = nil
+	e.client = nil
+	return nil
+}
+
+//ShellQuote quote args for /bin/sh
+func ShellQuote(args ...string)string{
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = "'" + strings.Replace(arg, "'", `'\''`, -1) + "'"
+	}
+	return strings.Join(quoted, " ")
+}
+
+//remoteCommand the command line run by the remote login shell, the pid of its process group is printed first
+func remoteCommand(cmd *Command)string{
+	path, args := cmd.Path, cmd.Args
+	if cmd.Limits != nil {
+		path, args = cmd.Limits.Wrap(path, args)
+	}
+	argv := GroupArgv(path, args, cmd.PTY)
+	switch cmd.EnvMode {
+	case ENV_MERGE:
+		if len(cmd.Env) > 0 {
+			argv = append(append([]string{"env"}, cmd.Env...), argv...)
+		}
+	case ENV_REPLACE:
+		argv = append(append([]string{"env", "-i"}, cmd.Env...), argv...)
+	}
+	line := "exec " + ShellQuote(argv...)
+	if cmd.Dir != "" {
+		line = "cd " + ShellQuote(cmd.Dir) + " && " + line
+	}
+	return line
+}
+
+//Start implement Executor
+func (e *SSHExecutor)Start(ctx context.Context, cmd *Command)(Process, error){
+	if cmd.Limits != nil && cmd.Limits.HasCgroup() {
+		return nil, fmt.Errorf("cgroup limits are not supported over ssh")
+	}
+	e.mu.Lock()
+	client, err := e.connect()
+	e.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("new ssh session error: %s", err.Error())
+	}
+	p := &sshProcess{client: client, session: session, tty: cmd.PTY, done: make(chan struct{})}
+	if cmd.PTY {
+		modes := ssh.TerminalModes{ssh.ECHO: 1}
+		err = session.RequestPty("xterm", int(cmd.WindowSize.Rows), int(cmd.WindowSize.Cols), modes)
+		if err != nil {
+			session.Close()
+			return nil, fmt.Errorf("request pty error: %s", err.Error())
+		}
+	}
+	session.Stdin = cmd.Stdin
+	stdout, err := session.StdoutPipe()
+	if err == nil && !cmd.PTY {
+		p.stderr, err = session.StderrPipe()
+	}
+	if err == nil {
+		err = session.Start(remoteCommand(cmd))
+	}
+	if err != nil {
+		session.Close()
+		return nil, fmt.Errorf("start ssh command error: %s", err.Error())
+	}
+	reader := bufio.NewReader(stdout)
+	line, err := reader.ReadString('\n')
+	p.pid, _ = strconv.Atoi(strings.TrimSpace(line))
+	if err != nil || p.pid == 0 {
+		session.Close()
+		if err == nil || err == io.EOF {
+			err = fmt.Errorf("get pid error: %q", line)
+		}
+		return nil, fmt.Errorf("start ssh command error: %s", err.Error())
+	}
+	p.stdout = reader
+	go func(){
+		select {
+		case <-ctx.Done():
+			p.killGroup()
+			session.Close()
+		case <-p.done:
+		}
+	}()
+	return p, nil
+}
+
+//sshProcess a command started in an ssh session
+type sshProcess struct {
+	client *ssh.Client
+	session *ssh.Session
+	pid int
+	tty bool
+	stdout io.Reader
+	stderr io.Reader
+	done chan struct{}
+	mu sync.Mutex
+	//signaled the last signal sent
+	signaled syscall.Signal
+}
+
+func (p *sshProcess)Pid()int{
+	return p.pid
+}
+
+func (p *sshProcess)Stdout()io.Reader{
+	return p.stdout
+}
+
+func (p *sshProcess)Stderr()io.Reader{
+	return p.stderr
+}
+
+//Signal send a signal with kill in another session, not every server supports signal requests
+func (p *sshProcess)Signal(sig os.Signal)error{
+	s, ok := sig.(syscall.Signal)
+	if !ok {
+		return fmt.Errorf("unsupported signal %s", sig.String())
+	}
+	p.setSignaled(s)
+	return p.run("kill -" + strconv.Itoa(int(s)) + " " + strconv.Itoa(p.pid))
+}
+
+//killGroup kill the command and its children
+func (p *sshProcess)killGroup()error{
+	p.setSignaled(syscall.SIGKILL)
+	return p.run(KillGroupScript(p.pid))
+}
+
+func (p *sshProcess)setSignaled(sig syscall.Signal){
+	p.mu.Lock()
+	p.signaled = sig
+	p.mu.Unlock()
+}
+
+//run run a command line in another session
+func (p *sshProcess)run(line string)error{
+	session, err := p.client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	return session.Run(line)
+}
+
+func (p *sshProcess)Resize(size WindowSize)error{
+	if !p.tty {
+		return fmt.Errorf("ssh session has no pty")
+	}
+	return p.session.WindowChange(int(size.Rows), int(size.Cols))
+}
+
+func (p *sshProcess)Wait()(*ExitStatus, error){
+	err := p.session.Wait()
+	close(p.done)
+	p.session.Close()
+	if err == nil {
+		return &ExitStatus{Code: 0, Message: "exit status 0"}, nil
+	}
+	if exitErr, ok := err.(*ssh.ExitError); ok {
+		if exitErr.Signal() != "" {
+			return &ExitStatus{Code: -1, Message: "signal: " + exitErr.Signal()}, nil
+		}
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return ExitCodeStatus(exitErr.ExitStatus(), p.signaled), nil
+	}
+	return nil, err
+}
@@ -0,0 +1,264 @@
+package shell
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+	"golang.org/x/crypto/ssh"
+)
+
+//testSSHServer an ssh server running the exec requests with the local /bin/sh
+type testSSHServer struct {
+	listener net.Listener
+	config *ssh.ServerConfig
+	//forwarded count of direct-tcpip channels
+	forwarded int32
+}
+
+func newTestSSHServer(t *testing.T, password string)*testSSHServer{
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(meta ssh.ConnMetadata, pass []byte)(*ssh.Permissions, error){
+			if string(pass) != password {
+				return nil, fmt.Errorf("wrong password")
+			}
+			return nil, nil
+		},
+	}
+	config.AddHostKey(signer)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &testSSHServer{listener: listener, config: config}
+	t.Cleanup(func(){ listener.Close() })
+	go s.serve()
+	return s
+}
+
+func (s *testSSHServer)addr()string{
+	return s.listener.Addr().String()
+}
+
+func (s *testSSHServer)serve(){
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go func(){
+			_, chans, reqs, err := ssh.NewServerConn(conn, s.config)
+			if err != nil {
+				conn.Close()
+				return
+			}
+			go ssh.DiscardRequests(reqs)
+			for newChannel := range chans {
+				switch newChannel.ChannelType() {
+				case "session":
+					go s.session(newChannel)
+				case "direct-tcpip":
+					go s.forward(newChannel)
+				default:
+					newChannel.Reject(ssh.UnknownChannelType, "unsupported")
+				}
+			}
+		}()
+	}
+}
+
+//session run the command of an exec request in a new session like sshd, nothing is killed when the channel is closed
+func (s *testSSHServer)session(newChannel ssh.NewChannel){
+	channel, reqs, err := newChannel.Accept()
+	if err != nil {
+		return
+	}
+	defer channel.Close()
+	for req := range reqs {
+		if req.Type != "exec" {
+			req.Reply(false, nil)
+			continue
+		}
+		var payload struct{ Command string }
+		ssh.Unmarshal(req.Payload, &payload)
+		req.Reply(true, nil)
+		cmd := exec.Command(SH, "-c", payload.Command)
+		cmd.Stdout = channel
+		cmd.Stderr = channel.Stderr()
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+		if err := cmd.Start(); err != nil {
+			return
+		}
+		go ssh.DiscardRequests(reqs)
+		cmd.Wait()
+		status := make([]byte, 4)
+		binary.BigEndian.PutUint32(status, uint32(cmd.ProcessState.ExitCode()))
+		channel.SendRequest("exit-status", false, status)
+		return
+	}
+}
+
+//forward a direct-tcpip channel of a jump host
+func (s *testSSHServer)forward(newChannel ssh.NewChannel){
+	var payload struct {
+		Host string
+		Port uint32
+		OriginHost string
+		OriginPort uint32
+	}
+	ssh.Unmarshal(newChannel.ExtraData(), &payload)
+	conn, err := net.Dial("tcp", net.JoinHostPort(payload.Host, strconv.Itoa(int(payload.Port))))
+	if err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	channel, reqs, err := newChannel.Accept()
+	if err != nil {
+		conn.Close()
+		return
+	}
+	atomic.AddInt32(&s.forwarded, 1)
+	go ssh.DiscardRequests(reqs)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func(){
+		defer wg.Done()
+		io.Copy(channel, conn)
+		channel.CloseWrite()
+	}()
+	go func(){
+		defer wg.Done()
+		io.Copy(conn, channel)
+		conn.(*net.TCPConn).CloseWrite()
+	}()
+	wg.Wait()
+	channel.Close()
+	conn.Close()
+}
+
+func testSSHConfig(addr string, password string)*SSHConfig{
+	return &SSHConfig{
+		Addr: addr,
+		User: "test",
+		Password: password,
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout: 5 * time.Second,
+	}
+}
+
+func TestSSHExecutor(t *testing.T){
+	server := newTestSSHServer(t, "secret")
+	executor := NewSSHExecutor(testSSHConfig(server.addr(), "secret"))
+	defer executor.Close()
+	s := NewWithShell(SH)
+	s.Executor = executor
+	err := s.Exec("echo out; echo err >&2; exit 3")
+	if err == nil || s.ExitCode() != 3 {
+		t.Fatalf("error %v, exit code %d", err, s.ExitCode())
+	}
+	streams := map[string]string{}
+	for _, msg := range s.Output().Messages() {
+		streams[msg.Stream] += msg.Text
+	}
+	if streams[STDOUT] != "out" || streams[STDERR] != "err" {
+		t.Errorf("output %v", streams)
+	}
+	if err := s.Exec("true"); err != nil || s.ExitCode() != 0 {
+		t.Errorf("error %v, exit code %d", err, s.ExitCode())
+	}
+}
+
+func TestSSHExecutorTimeout(t *testing.T){
+	server := newTestSSHServer(t, "secret")
+	executor := NewSSHExecutor(testSSHConfig(server.addr(), "secret"))
+	defer executor.Close()
+	s := NewWithShell(SH)
+	s.Executor = executor
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	begin := time.Now()
+	err := s.ExecContext(ctx, "sleep 30 & echo child $!; sleep 5; echo finished")
+	if err == nil || s.ExitCode() != -1 {
+		t.Errorf("error %v, exit code %d after the timeout", err, s.ExitCode())
+	}
+	if elapsed := time.Since(begin); elapsed > 3*time.Second {
+		t.Errorf("killed after %s", elapsed)
+	}
+	child := 0
+	for _, msg := range s.Output().Messages() {
+		if msg.Text == "finished" {
+			t.Error("output after the timeout")
+		}
+		fmt.Sscanf(msg.Text, "child %d", &child)
+	}
+	if child == 0 {
+		t.Fatal("no child pid")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if running(child) {
+		syscall.Kill(child, syscall.SIGKILL)
+		t.Error("child of the command is running after the timeout")
+	}
+}
+
+//running whether a process is running, a zombie is not
+func running(pid int)bool{
+	data, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return false
+	}
+	fields := strings.Fields(string(data[strings.LastIndexByte(string(data), ')')+1:]))
+	return len(fields) > 0 && fields[0] != "Z"
+}
+
+func TestSSHExecutorJumpHost(t *testing.T){
+	jump := newTestSSHServer(t, "jump")
+	target := newTestSSHServer(t, "target")
+	config := testSSHConfig(target.addr(), "target")
+	config.JumpHosts = []*SSHConfig{testSSHConfig(jump.addr(), "jump")}
+	executor := NewSSHExecutor(config)
+	defer executor.Close()
+	s := NewWithShell(SH)
+	s.Executor = executor
+	if err := s.Exec("echo through"); err != nil {
+		t.Fatal(err)
+	}
+	msgs := s.Output().Messages()
+	if len(msgs) != 1 || msgs[0].Text != "through" {
+		t.Errorf("output %v", msgs)
+	}
+	if n := atomic.LoadInt32(&jump.forwarded); n != 1 {
+		t.Errorf("%d connections forwarded by the jump host", n)
+	}
+}
+
+func TestSSHExecutorAuthFailure(t *testing.T){
+	server := newTestSSHServer(t, "secret")
+	executor := NewSSHExecutor(testSSHConfig(server.addr(), "wrong"))
+	defer executor.Close()
+	s := NewWithShell(SH)
+	s.Executor = executor
+	if err := s.Exec("true"); err == nil {
+		t.Error("connected with a wrong password")
+	}
+}
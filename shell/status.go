@@ -0,0 +1,80 @@
+///////////////////////////////////////////////////////////
+// status.go
+// shell status and state changes
+// ycyxuehan kun1.huang@outlook.com
+//////////////////////////////////////////////////////////
+
+package shell
+
+import (
+	"fmt"
+	"time"
+)
+
+type ShellStatus int
+
+//the zero value is UNKOWN, a shell never started
+const (
+	UNKOWN ShellStatus = iota
+	CREATED
+	STARTED
+	RUNNING
+	EXITED
+	ERROR
+	WAIT
+)
+
+func (s *ShellStatus)ToString()string{
+	switch *s {
+	case CREATED: return "created"
+	case STARTED: return "started"
+	case RUNNING: return "running"
+	case EXITED: return "exited"
+	case ERROR: return "error"
+	case WAIT: return "wait"
+	}
+	return "unkown"
+}
+
+//String implement fmt.Stringer
+func (s ShellStatus)String()string{
+	return s.ToString()
+}
+
+//Finished whether the command is finished
+func (s ShellStatus)Finished()bool{
+	return s == EXITED || s == ERROR
+}
+
+//transitions the allowed status changes
+var transitions = map[ShellStatus][]ShellStatus{
+	UNKOWN: {WAIT, CREATED},
+	WAIT: {CREATED, ERROR},
+	CREATED: {STARTED, ERROR},
+	STARTED: {RUNNING, ERROR},
+	RUNNING: {EXITED, ERROR},
+	EXITED: {WAIT, CREATED},
+	ERROR: {WAIT, CREATED},
+}
+
+//CanTransit whether the status can change to another
+func (s ShellStatus)CanTransit(to ShellStatus)bool{
+	for _, status := range transitions[s] {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
+
+//StatusEvent a status change
+type StatusEvent struct {
+	From ShellStatus
+	To ShellStatus
+	Time time.Time
+}
+
+//String implement fmt.Stringer
+func (e StatusEvent)String()string{
+	return fmt.Sprintf("%s -> %s", e.From, e.To)
+}
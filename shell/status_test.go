@@ -0,0 +1,94 @@
+package shell
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestZeroShell(t *testing.T){
+	var s Shell
+	if s.GetStatus() != UNKOWN {
+		t.Fatalf("zero status %s", s.GetStatus())
+	}
+	if err := s.Wait(); err == nil {
+		t.Error("wait of a shell never started")
+	}
+	if err := s.Exec("echo hi"); err != nil {
+		t.Fatal(err)
+	}
+	if s.GetStatus() != EXITED || s.ExitCode() != 0 {
+		t.Errorf("status %s, exit code %d", s.GetStatus(), s.ExitCode())
+	}
+}
+
+func TestStartConcurrent(t *testing.T){
+	for round := 0; round < 20; round++ {
+		s := NewWithShell(SH)
+		var events []StatusEvent
+		var mu sync.Mutex
+		s.OnStatusChange(func(e StatusEvent){
+			mu.Lock()
+			events = append(events, e)
+			mu.Unlock()
+		})
+		var started int32
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func(){
+				defer wg.Done()
+				if s.Start("true") == nil {
+					atomic.AddInt32(&started, 1)
+				}
+				s.GetStatus()
+				s.Done()
+			}()
+		}
+		wg.Wait()
+		if started != 1 {
+			t.Fatalf("%d callers started a command", started)
+		}
+		if err := s.Wait(); err != nil {
+			t.Fatal(err)
+		}
+		mu.Lock()
+		for i, e := range events {
+			if !e.From.CanTransit(e.To) || (i > 0 && events[i-1].To != e.From) {
+				t.Errorf("invalid status changes %v", events)
+				break
+			}
+		}
+		mu.Unlock()
+	}
+}
+
+func TestQueueCancelConcurrent(t *testing.T){
+	for round := 0; round < 20; round++ {
+		s := NewWithShell(SH)
+		if err := s.queue(); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.queue(); err == nil {
+			t.Fatal("queued twice")
+		}
+		var wg sync.WaitGroup
+		var startErr error
+		var cancelled bool
+		wg.Add(2)
+		go func(){
+			defer wg.Done()
+			startErr = s.start(context.Background(), true, "true")
+		}()
+		go func(){
+			defer wg.Done()
+			cancelled = s.cancel(nil)
+		}()
+		wg.Wait()
+		if (startErr == nil) == cancelled {
+			t.Fatalf("start error %v, cancelled %t", startErr, cancelled)
+		}
+		s.Wait()
+	}
+}